@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
 	"os/exec"
+	"time"
 
 	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+	"github.com/tommywijayac/duck-queue-server-v2/services"
 )
 
 type AdminController struct {
@@ -27,12 +33,7 @@ func (c *AdminController) ExitDispenserApp() {
 		return
 	}
 
-	wantPIN, err := web.AppConfig.String("app::admin_pin")
-	if err != nil {
-		wantPIN = ""
-	}
-
-	if wantPIN != req.PIN {
+	if !isAdminPIN(req.PIN) {
 		c.Ctx.Output.SetStatus(http.StatusUnauthorized)
 		c.Data["json"] = map[string]string{
 			"error": "Unauthorized",
@@ -42,7 +43,7 @@ func (c *AdminController) ExitDispenserApp() {
 	}
 
 	cmd := exec.Command("systemctl", "stop", "dispenser")
-	_, err = cmd.CombinedOutput()
+	_, err := cmd.CombinedOutput()
 	if err != nil {
 		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
 		c.Data["json"] = map[string]string{
@@ -59,3 +60,578 @@ func (c *AdminController) ExitDispenserApp() {
 	}
 	c.ServeJSON()
 }
+
+func isAdminPIN(pin string) bool {
+	wantPIN, err := web.AppConfig.String("app::admin_pin")
+	if err != nil {
+		wantPIN = ""
+	}
+
+	return wantPIN == pin
+}
+
+func (c *AdminController) authorize() bool {
+	return authorizeAdmin(&c.Controller)
+}
+
+// authorizeAdmin checks admin PIN given in X-Admin-PIN header, and replies unauthorized if it doesn't match
+func authorizeAdmin(c *web.Controller) bool {
+	if isAdminPIN(c.Ctx.Input.Header("X-Admin-PIN")) {
+		return true
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusUnauthorized)
+	c.Data["json"] = map[string]string{
+		"error": "Unauthorized",
+	}
+	c.ServeJSON()
+	return false
+}
+
+// ListClients lists live event stream connections per room
+func (c *AdminController) ListClients() {
+	if !c.authorize() {
+		return
+	}
+
+	clients, err := EventHubService.ListClients()
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Fail to list clients",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"rooms": clients,
+	}
+	c.ServeJSON()
+}
+
+// DisconnectClient force closes all connections of the client
+func (c *AdminController) DisconnectClient() {
+	if !c.authorize() {
+		return
+	}
+
+	clientID := c.Ctx.Input.Param(":client_id")
+
+	n, err := EventHubService.DisconnectClient(clientID)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Fail to disconnect client",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if n == 0 {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error": "Client not found",
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"message":     "Client disconnected successfully",
+		"connections": n,
+	}
+	c.ServeJSON()
+}
+
+// ReloadClient asks the client, e.g. display, to reload its page
+func (c *AdminController) ReloadClient() {
+	if !c.authorize() {
+		return
+	}
+
+	clientID := c.Ctx.Input.Param(":client_id")
+
+	err := DisplayService.SendClientCommand(clientID, models.DisplayCommand{
+		Command: models.DisplayCommandReload,
+	})
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Fail to send reload",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"message": "Reload sent successfully",
+	}
+	c.ServeJSON()
+}
+
+type displayCommandRequest struct {
+	Command  models.DisplayCommandName `json:"command"`
+	Message  string                    `json:"message"`
+	Duration int                       `json:"duration"` // banner duration in seconds, 0 means until cleared
+	Language string                    `json:"language"`
+	IsMuted  bool                      `json:"muted"`
+}
+
+func (req displayCommandRequest) toCommand() models.DisplayCommand {
+	cmd := models.DisplayCommand{
+		Command:  req.Command,
+		Message:  req.Message,
+		Language: req.Language,
+		IsMuted:  req.IsMuted,
+	}
+	if req.Duration > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.Duration) * time.Second)
+		cmd.ExpiresAt = &expiresAt
+	}
+	return cmd
+}
+
+// ControlRoomDisplays pushes control command to all displays of the room
+func (c *AdminController) ControlRoomDisplays() {
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+	roomID := c.Ctx.Input.Param(":id")
+
+	if roomID != models.InternalRoomIDDisplay {
+		if _, err := RoomService.GetRoom(ctx, roomID); err != nil {
+			c.Ctx.Output.SetStatus(http.StatusNotFound)
+			c.Data["json"] = map[string]string{
+				"error":       "Room not found",
+				"dev_message": err.Error(),
+			}
+			c.ServeJSON()
+			return
+		}
+	}
+
+	var req displayCommandRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid input",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	if err := DisplayService.SendRoomCommand(roomID, req.toCommand()); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Fail to send command",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"message": "Command sent successfully",
+	}
+	c.ServeJSON()
+}
+
+// ControlClientDisplay pushes control command to a specific display
+func (c *AdminController) ControlClientDisplay() {
+	if !c.authorize() {
+		return
+	}
+
+	clientID := c.Ctx.Input.Param(":client_id")
+
+	var req displayCommandRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid input",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	if err := DisplayService.SendClientCommand(clientID, req.toCommand()); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Fail to send command",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"message": "Command sent successfully",
+	}
+	c.ServeJSON()
+}
+
+func (c *AdminController) ListAnnouncements() {
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+
+	announcements, err := AnnouncementService.List(ctx)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to list announcements",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"announcements": announcements,
+	}
+	c.ServeJSON()
+}
+
+func (c *AdminController) CreateAnnouncement() {
+	type Request struct {
+		Text     string    `json:"text"`
+		ImageURL string    `json:"image_url"`
+		RoomIDs  []string  `json:"room_ids"`
+		StartAt  time.Time `json:"start_at"`
+		EndAt    time.Time `json:"end_at"`
+		Priority int       `json:"priority"`
+	}
+
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+
+	var req Request
+	if err := c.BindJSON(&req); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid input",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	announcement, err := AnnouncementService.Create(ctx, models.Announcement{
+		Text:     req.Text,
+		ImageURL: req.ImageURL,
+		RoomIDs:  req.RoomIDs,
+		StartAt:  req.StartAt,
+		EndAt:    req.EndAt,
+		Priority: req.Priority,
+	})
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to create announcement",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusCreated)
+	c.Data["json"] = map[string]interface{}{
+		"message":      "Announcement created successfully",
+		"announcement": announcement,
+	}
+	c.ServeJSON()
+}
+
+func (c *AdminController) DeleteAnnouncement() {
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+	announcementID := c.Ctx.Input.Param(":announcement_id")
+
+	if err := AnnouncementService.Delete(ctx, announcementID); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to delete announcement",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"message": "Announcement deleted successfully",
+	}
+	c.ServeJSON()
+}
+
+// GetTicketHistory returns where the ticket has been and for how long, to trace complaints
+func (c *AdminController) GetTicketHistory() {
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+	number := c.Ctx.Input.Param(":number")
+
+	history, err := TicketService.GetHistory(ctx, number)
+	if errors.Is(err, services.ErrTicketNotFound) {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Ticket not found",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to get ticket history",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"number":  number,
+		"history": history,
+	}
+	c.ServeJSON()
+}
+
+// GetDailyReport returns throughput and timing of a day as json, or csv with format=csv.
+// Date is YYYY-MM-DD business day, default to today.
+func (c *AdminController) GetDailyReport() {
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+	dateQuery := c.Ctx.Input.Query("date")
+	format := c.Ctx.Input.Query("format")
+
+	date := models.BusinessToday()
+	if dateQuery != "" {
+		var err error
+		date, err = parseDate(dateQuery)
+		if err != nil {
+			c.Ctx.Output.SetStatus(http.StatusBadRequest)
+			c.Data["json"] = map[string]string{
+				"error":       "Invalid date, expected YYYY-MM-DD",
+				"dev_message": err.Error(),
+			}
+			c.ServeJSON()
+			return
+		}
+	}
+
+	report, err := ReportService.GetDailyReport(ctx, date)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to build report",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+			c.Data["json"] = map[string]string{
+				"error":       "Failed to write report",
+				"dev_message": err.Error(),
+			}
+			c.ServeJSON()
+			return
+		}
+
+		c.Ctx.Output.Header("Content-Type", "text/csv")
+		c.Ctx.Output.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"report-%s.csv\"", report.Date))
+		c.Ctx.Output.SetStatus(http.StatusOK)
+		c.Ctx.Output.Body(buf.Bytes())
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = report
+	c.ServeJSON()
+}
+
+func parseDate(value string) (time.Time, error) {
+	return models.ParseBusinessDate(value)
+}
+
+func (c *AdminController) ListArchivedDays() {
+	if !c.authorize() {
+		return
+	}
+
+	days, err := ArchiveService.ListDays(c.Ctx.Request.Context())
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to list archived days",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"days": days,
+	}
+	c.ServeJSON()
+}
+
+func (c *AdminController) ListArchivedTickets() {
+	if !c.authorize() {
+		return
+	}
+
+	date, err := parseDate(c.Ctx.Input.Param(":date"))
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid date, expected YYYY-MM-DD",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	tickets, err := ArchiveService.ListTickets(c.Ctx.Request.Context(), date)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to list archived tickets",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"date":    date.Format("2006-01-02"),
+		"tickets": tickets,
+	}
+	c.ServeJSON()
+}
+
+func (c *AdminController) GetArchivedTicketHistory() {
+	if !c.authorize() {
+		return
+	}
+
+	number := c.Ctx.Input.Param(":number")
+	date, err := parseDate(c.Ctx.Input.Param(":date"))
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid date, expected YYYY-MM-DD",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	history, err := ArchiveService.GetTicketJourney(c.Ctx.Request.Context(), date, number)
+	if errors.Is(err, services.ErrTicketNotFound) {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Ticket not found in archive",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to get archived ticket history",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"date":    date.Format("2006-01-02"),
+		"number":  number,
+		"history": history,
+	}
+	c.ServeJSON()
+}
+
+// ListAppointments returns appointments of the room on a day, by slot. Date is YYYY-MM-DD business day, default to today.
+func (c *AdminController) ListAppointments() {
+	if !c.authorize() {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+	roomID := c.Ctx.Input.Param(":id")
+	dateQuery := c.Ctx.Input.Query("date")
+
+	date := models.BusinessToday()
+	if dateQuery != "" {
+		var err error
+		date, err = parseDate(dateQuery)
+		if err != nil {
+			c.Ctx.Output.SetStatus(http.StatusBadRequest)
+			c.Data["json"] = map[string]string{
+				"error":       "Invalid date, expected YYYY-MM-DD",
+				"dev_message": err.Error(),
+			}
+			c.ServeJSON()
+			return
+		}
+	}
+
+	appointments, err := AppointmentService.List(ctx, roomID, date)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to list appointments",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"room_id":      roomID,
+		"date":         date.Format("2006-01-02"),
+		"appointments": appointments,
+	}
+	c.ServeJSON()
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+type AppointmentController struct {
+	web.Controller
+}
+
+// error codes for booking, so front desk can show proper message instead of generic failure
+const (
+	// all seats of the slot are booked
+	ErrorCodeSlotFull = "slot_full"
+)
+
+// BookAppointment books a slot of the room. The booking code is used to check in at dispenser on the day.
+// It's public for patients, so it's rate limited per client IP.
+func (c *AppointmentController) BookAppointment() {
+	type Request struct {
+		Name   string    `json:"name"`
+		Phone  string    `json:"phone"`
+		SlotAt time.Time `json:"slot_at"` // RFC3339, must start on a slot boundary of the room
+	}
+
+	ctx := c.Ctx.Request.Context()
+	roomID := c.Ctx.Input.Param(":id")
+
+	isAllowed, retryAfter := AppointmentService.AllowBooking(ctx, clientIP(c.Ctx))
+	if !isAllowed {
+		c.Ctx.Output.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.Ctx.Output.SetStatus(http.StatusTooManyRequests)
+		c.Data["json"] = map[string]string{
+			"error":       "Too many requests, please try again later",
+			"dev_message": "appointment booking rate limit exceeded",
+		}
+		c.ServeJSON()
+		return
+	}
+
+	if _, err := RoomService.GetRoom(ctx, roomID); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Room not found",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	var req Request
+	if err := c.BindJSON(&req); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid input",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if req.Name == "" || req.Phone == "" {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Name and phone are required",
+			"dev_message": "missing name or phone",
+		}
+		c.ServeJSON()
+		return
+	}
+
+	appointment, err := AppointmentService.Book(ctx, roomID, models.QueueInfo{
+		Name:  req.Name,
+		Phone: req.Phone,
+	}, req.SlotAt)
+	if errors.Is(err, models.ErrAppointmentDisabled) || errors.Is(err, models.ErrInvalidSlot) {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Slot is not available",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if errors.Is(err, models.ErrSlotFull) {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = map[string]string{
+			"error":       "Slot is fully booked",
+			"code":        ErrorCodeSlotFull,
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to book appointment",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusCreated)
+	c.Data["json"] = map[string]interface{}{
+		"message":     "Appointment booked successfully",
+		"appointment": appointment,
+	}
+	c.ServeJSON()
+}
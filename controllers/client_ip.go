@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/beego/beego/v2/server/web"
+	beecontext "github.com/beego/beego/v2/server/web/context"
+)
+
+// proxies in front of the server, whose X-Forwarded-For is trusted
+var trustedProxies []netip.Prefix
+
+// loadTrustedProxies reads comma separated proxy IPs or CIDRs, e.g. "127.0.0.1, 10.0.0.0/8"
+func loadTrustedProxies() error {
+	cfg, err := web.AppConfig.String("app::trusted_proxies")
+	if err != nil {
+		cfg = ""
+	}
+
+	trustedProxies = nil
+	for _, v := range strings.Split(cfg, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+			}
+			trustedProxies = append(trustedProxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+		}
+		trustedProxies = append(trustedProxies, prefix.Masked())
+	}
+	return nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns IP of the client, e.g. to rate limit it. X-Forwarded-For is set by the client,
+// so it's only used when the connection comes from a trusted proxy, and only the hops added by
+// trusted proxies are skipped.
+func clientIP(ctx *beecontext.Context) string {
+	host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil {
+		host = ctx.Request.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	if !isTrustedProxy(addr) {
+		return addr.String()
+	}
+
+	// nearest hop is the last one
+	hops := strings.Split(strings.Join(ctx.Request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !isTrustedProxy(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
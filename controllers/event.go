@@ -1,16 +1,179 @@
 package controllers
 
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	beecontext "github.com/beego/beego/v2/server/web/context"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+	"github.com/tommywijayac/duck-queue-server-v2/services"
+)
+
 func (c *RoomController) StreamRoomEvents() {
+	ctx := c.Ctx.Request.Context()
 	roomID := c.Ctx.Input.Param(":id")
-	clientID := c.Ctx.Input.Query(":client_id")
 
-	c.Ctx.Output.Header("Content-Type", "text/event-stream")
-	c.Ctx.Output.Header("Cache-Control", "no-cache")
-	c.Ctx.Output.Header("Connection", "keep-alive")
-	c.Ctx.Output.Header("Access-Control-Allow-Origin", "*")
-	c.Ctx.Output.Header("Access-Control-Allow-Headers", "Cache-Control")
+	lastEventID := startEventStream(c.Ctx)
+
+	transport := models.NewSSETransport(c.Ctx.ResponseWriter)
+	client := EventHubService.NewClient(newClientInfo(c.Ctx, models.ClientTransportSSE), transport)
+	if err := transport.WriteRetry(5 * time.Second); err != nil {
+		logs.Info("fail to send message to client %s: %s", client.ID, err.Error())
+		return
+	}
+	subscribeRoom(ctx, client, roomID, lastEventID)
+
+	// blocks until client disconnects or is evicted
+	client.WritePump(ctx)
+	EventHubService.UnsubscribeAll(client)
+}
+
+// StreamEvents streams events of multiple rooms on a single connection, e.g. for lobby display.
+// Rooms are given as ?rooms=A,B,DISPLAY and optionally filtered by ?events=call,snapshot
+func (c *RoomController) StreamEvents() {
+	ctx := c.Ctx.Request.Context()
+	roomIDs := splitQuery(c.Ctx.Input.Query("rooms"))
+	eventNames := splitQuery(c.Ctx.Input.Query("events"))
+
+	if len(roomIDs) == 0 {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error": "Invalid input",
+		}
+		c.ServeJSON()
+		return
+	}
+	for _, roomID := range roomIDs {
+		if roomID == models.InternalRoomIDDisplay {
+			continue
+		}
+		if _, err := RoomService.GetRoom(ctx, roomID); err != nil {
+			c.Ctx.Output.SetStatus(http.StatusNotFound)
+			c.Data["json"] = map[string]string{
+				"error":       "Room not found",
+				"dev_message": err.Error(),
+			}
+			c.ServeJSON()
+			return
+		}
+	}
+
+	lastIDs := models.ParseMultiRoomEventID(startEventStream(c.Ctx))
+
+	transport := models.NewMultiRoomSSETransport(c.Ctx.ResponseWriter, lastIDs)
+	client := EventHubService.NewClient(newClientInfo(c.Ctx, models.ClientTransportSSE), transport)
+	if err := transport.WriteRetry(5 * time.Second); err != nil {
+		logs.Info("fail to send message to client %s: %s", client.ID, err.Error())
+		return
+	}
+
+	client.SetEventFilter(eventNames)
+	for _, roomID := range roomIDs {
+		lastRoomEventID := ""
+		if lastID, ok := lastIDs[roomID]; ok {
+			lastRoomEventID = strconv.FormatUint(lastID, 10)
+		}
+		subscribeRoom(ctx, client, roomID, lastRoomEventID)
+	}
+
+	// blocks until client disconnects or is evicted
+	client.WritePump(ctx)
+	EventHubService.UnsubscribeAll(client)
+}
+
+// startEventStream sets SSE response headers, and returns id of the last event client received before reconnecting
+func startEventStream(ctx *beecontext.Context) string {
+	ctx.Output.Header("Content-Type", "text/event-stream")
+	ctx.Output.Header("Cache-Control", "no-cache")
+	ctx.Output.Header("Connection", "keep-alive")
+	ctx.Output.Header("Access-Control-Allow-Origin", "*")
+	ctx.Output.Header("Access-Control-Allow-Headers", "Cache-Control")
+
+	// browser sends Last-Event-ID header on reconnect. query param is for EventSource polyfills
+	lastEventID := ctx.Input.Header("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Input.Query("last_event_id")
+	}
+	return lastEventID
+}
+
+// newClientInfo identifies client by ?client_id and ?kind, e.g. ?client_id=tv-lobby&kind=display.
+// Client id is generated if not given.
+func newClientInfo(ctx *beecontext.Context, transport string) models.ClientInfo {
+	return models.ClientInfo{
+		ID:        ctx.Input.Query("client_id"),
+		Kind:      models.ClientKind(ctx.Input.Query("kind")),
+		Transport: transport,
+		IP:        clientIP(ctx),
+		UserAgent: ctx.Input.UserAgent(),
+	}
+}
+
+func splitQuery(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" && !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// subscribeRoom subscribes client to room events. New client starts from full state,
+// so does reconnecting client whose missed events are gone.
+//
+// Snapshot is taken before subscribing and stamped with the last event it includes, then events after it are replayed.
+// Otherwise a live event could arrive before an older snapshot, and be undone by it.
+func subscribeRoom(ctx context.Context, client *models.Client, roomID, lastEventID string) {
+	if lastEventID != "" && EventHubService.Subscribe(roomID, client, lastEventID) {
+		return
+	}
+
+	snapshotEventID := EventHubService.LastEventID(roomID)
+	if err := sendSnapshot(ctx, client, roomID, snapshotEventID); err != nil {
+		logs.Error("fail to send snapshot to client %s: %s", client.ID, err.Error())
+	}
+
+	if !EventHubService.Subscribe(roomID, client, strconv.FormatUint(snapshotEventID, 10)) {
+		// more events than replay buffer arrived while taking the snapshot
+		logs.Warn("%s: events after snapshot of client %s are evicted", roomID, client.ID)
+		EventHubService.Subscribe(roomID, client, "")
+	}
+}
+
+func sendSnapshot(ctx context.Context, client *models.Client, roomID string, eventID uint64) error {
+	var snapshot services.RoomSnapshot
+	var err error
+	if roomID == models.InternalRoomIDDisplay {
+		// internal display room has no queue, its snapshot only has announcements
+		snapshot = services.RoomSnapshot{
+			Details: services.RoomSnapshotDetails{RoomID: roomID},
+			Queues:  map[string][]models.QueueItem{},
+		}
+	} else {
+		snapshot, err = RoomService.GetRoomSnapshot(ctx, roomID)
+		if err != nil {
+			return err
+		}
+	}
+
+	snapshot.Announcements, err = AnnouncementService.ListActive(ctx, roomID)
+	if err != nil {
+		return err
+	}
+
+	event, err := models.NewEvent(models.EventSnapshot, snapshot)
+	if err != nil {
+		return err
+	}
+	event.ID = eventID
 
-	EventHubService.RegisterClient(roomID, clientID, c.Ctx.ResponseWriter)
-	<-c.Ctx.Request.Context().Done()
-	EventHubService.UnregisterClient(roomID, clientID)
+	client.Enqueue(roomID, event)
+	return nil
 }
@@ -1,28 +1,41 @@
 package controllers
 
 import (
-	"time"
-
+	"github.com/tommywijayac/duck-queue-server-v2/models"
 	"github.com/tommywijayac/duck-queue-server-v2/services"
 )
 
 var (
-	loc             *time.Location
-	RoomService     *services.RoomService
-	CallService     *services.CallService
-	PrinterService  *services.PrinterService
-	EventHubService *services.EventHubService
+	RoomService         *services.RoomService
+	CallService         *services.CallService
+	PrinterService      *services.PrinterService
+	EventHubService     *services.EventHubService
+	DisplayService      *services.DisplayService
+	AnnouncementService *services.AnnouncementService
+	TicketService       *services.TicketService
+	ReportService       *services.ReportService
+	ArchiveService      *services.ArchiveService
+	MetricsService      *services.MetricsService
+	AppointmentService  *services.AppointmentService
 )
 
 func Init() {
-	var err error
-	loc, err = time.LoadLocation("Asia/Jakarta")
-	if err != nil {
+	if err := models.InitBusinessDay(); err != nil {
+		panic(err)
+	}
+	if err := loadTrustedProxies(); err != nil {
 		panic(err)
 	}
 
-	PrinterService = services.NewPrinterService()
-	RoomService = services.NewRoomService(PrinterService)
-	CallService = services.NewCallService(RoomService)
 	EventHubService = services.NewEventHubService()
+	DisplayService = services.NewDisplayService(EventHubService)
+	PrinterService = services.NewPrinterService(EventHubService)
+	RoomService = services.NewRoomService(PrinterService, EventHubService)
+	CallService = services.NewCallService(RoomService, EventHubService)
+	AnnouncementService = services.NewAnnouncementService(RoomService, EventHubService)
+	TicketService = services.NewTicketService(RoomService)
+	AppointmentService = services.NewAppointmentService(RoomService)
+	ArchiveService = services.NewArchiveService()
+	ReportService = services.NewReportService(RoomService, CallService, ArchiveService)
+	MetricsService = services.NewMetricsService(RoomService, EventHubService, CallService)
 }
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/services"
+)
+
+type PrinterController struct {
+	web.Controller
+}
+
+// PreviewTicket renders ticket of a room as pdf or png, so template can be designed without physical printer.
+// It's for admin only, since rendering png runs pdftoppm per request.
+func (c *PrinterController) PreviewTicket() {
+	if !authorizeAdmin(&c.Controller) {
+		return
+	}
+
+	ctx := c.Ctx.Request.Context()
+	roomID := c.Ctx.Input.Query("room")
+	number := c.Ctx.Input.Query("number")
+	format := c.Ctx.Input.Query("format")
+	if format == "" {
+		format = services.PreviewFormatPDF
+	}
+
+	room, err := RoomService.GetRoom(ctx, roomID)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Room not found",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	// sample number, as if it's the first ticket of the day
+	if number == "" {
+		number, err = room.Numbering.Format(1, "")
+		if err != nil {
+			number = roomID
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := PrinterService.PreviewQueue(&buf, number, format); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to render ticket",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	switch format {
+	case services.PreviewFormatPNG:
+		c.Ctx.Output.Header("Content-Type", "image/png")
+	default:
+		c.Ctx.Output.Header("Content-Type", "application/pdf")
+	}
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Ctx.Output.Body(buf.Bytes())
+}
+
+// GetPrinterStatus returns status of all printers, or only the printer serving
+// the dispenser if room or client_id is given.
+func (c *PrinterController) GetPrinterStatus() {
+	roomID := c.Ctx.Input.Query("room")
+	clientID := c.Ctx.Input.Query("client_id")
+
+	if roomID == "" && clientID == "" {
+		c.Ctx.Output.SetStatus(http.StatusOK)
+		c.Data["json"] = map[string]interface{}{
+			"printers": PrinterService.GetStatuses(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	status, err := PrinterService.GetStatus(roomID, clientID)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Printer not found",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"status": status,
+	}
+	c.ServeJSON()
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/beego/beego/v2/server/web"
 	"github.com/tommywijayac/duck-queue-server-v2/models"
@@ -11,11 +13,56 @@ type RoomController struct {
 	web.Controller
 }
 
+// error codes for dispenser, so it can show proper message instead of generic failure
+const (
+	// room can't accept more tickets until next business day
+	ErrorCodeRoomFullToday = "room_full_today"
+	// too many tickets are waiting, room accepts new tickets once some are served
+	ErrorCodeRoomQueueFull = "room_queue_full"
+	// outside opening hours, or after last ticket cutoff
+	ErrorCodeRoomClosed = "room_closed"
+	// booking code was already used to get a ticket
+	ErrorCodeAppointmentCheckedIn = "appointment_checked_in"
+	// booking code is for another day
+	ErrorCodeAppointmentNotToday = "appointment_not_today"
+)
+
+// capacityErrorCode returns error code if err is caused by room capacity, otherwise empty string
+func capacityErrorCode(err error) string {
+	switch {
+	case errors.Is(err, models.ErrQueueFullToday), errors.Is(err, models.ErrQueueNumberExceeded):
+		return ErrorCodeRoomFullToday
+	case errors.Is(err, models.ErrQueueFull):
+		return ErrorCodeRoomQueueFull
+	}
+	return ""
+}
+
+// roomClosedResponse returns error response if err is caused by room being closed, otherwise nil
+func roomClosedResponse(err error) map[string]string {
+	var closedErr *models.RoomClosedError
+	if !errors.As(err, &closedErr) {
+		return nil
+	}
+
+	resp := map[string]string{
+		"error":       "Room is closed",
+		"code":        ErrorCodeRoomClosed,
+		"dev_message": err.Error(),
+	}
+	if closedErr.NextOpenAt != nil {
+		resp["next_open_at"] = closedErr.NextOpenAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
 func (c *RoomController) CreateRoomQueue() {
 	type Request struct {
 		DestinationRoomID string `json:"destination_room_id"`
+		ClientID          string `json:"client_id"` // dispenser id, to route ticket to nearest printer
 		Name              string `json:"name"`
 		Phone             string `json:"phone"`
+		Priority          string `json:"priority"` // optional priority class, see room numbering
 	}
 
 	ctx := c.Ctx.Request.Context()
@@ -32,10 +79,27 @@ func (c *RoomController) CreateRoomQueue() {
 		return
 	}
 
-	createdQueue, err := RoomService.CreateQueue(ctx, roomID, req.DestinationRoomID, models.QueueInfo{
-		Name:  req.Name,
-		Phone: req.Phone,
+	createdQueue, err := RoomService.CreateQueue(ctx, roomID, req.DestinationRoomID, req.ClientID, models.QueueInfo{
+		Name:     req.Name,
+		Phone:    req.Phone,
+		Priority: req.Priority,
 	})
+	if resp := roomClosedResponse(err); resp != nil {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = resp
+		c.ServeJSON()
+		return
+	}
+	if code := capacityErrorCode(err); code != "" {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = map[string]string{
+			"error":       "Room is full",
+			"code":        code,
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
 	if err != nil {
 		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
 		c.Data["json"] = map[string]string{
@@ -54,6 +118,93 @@ func (c *RoomController) CreateRoomQueue() {
 	c.ServeJSON()
 }
 
+// CheckInAppointment creates a queue from booking code at dispenser. Room id is the dispenser room,
+// the queue is created in the room the appointment is booked for.
+func (c *RoomController) CheckInAppointment() {
+	type Request struct {
+		ClientID string `json:"client_id"` // dispenser id, to route ticket to nearest printer
+		Code     string `json:"code"`
+	}
+
+	ctx := c.Ctx.Request.Context()
+	roomID := c.Ctx.Input.Param(":id")
+
+	var req Request
+	if err := c.BindJSON(&req); err != nil {
+		c.Ctx.Output.SetStatus(http.StatusBadRequest)
+		c.Data["json"] = map[string]string{
+			"error":       "Invalid input",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	createdQueue, appointment, err := RoomService.CheckInAppointment(ctx, roomID, req.ClientID, req.Code)
+	if errors.Is(err, models.ErrAppointmentNotFound) {
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Booking code not found",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if errors.Is(err, models.ErrAppointmentCheckedIn) {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = map[string]string{
+			"error":       "Booking code is already checked in",
+			"code":        ErrorCodeAppointmentCheckedIn,
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if errors.Is(err, models.ErrAppointmentNotToday) {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = map[string]string{
+			"error":       "Appointment is not for today",
+			"code":        ErrorCodeAppointmentNotToday,
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if resp := roomClosedResponse(err); resp != nil {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = resp
+		c.ServeJSON()
+		return
+	}
+	if code := capacityErrorCode(err); code != "" {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = map[string]string{
+			"error":       "Room is full",
+			"code":        code,
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to check in appointment",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusCreated)
+	c.Data["json"] = map[string]interface{}{
+		"message":     "Appointment checked in successfully",
+		"queue":       createdQueue,
+		"appointment": appointment,
+	}
+	c.ServeJSON()
+}
+
 func (c *RoomController) ProcessRoomQueue() {
 	type Request struct {
 		OriginQueue string `json:"origin_queue"`
@@ -153,6 +304,16 @@ func (c *RoomController) MoveRoomQueue() {
 	}
 
 	err := RoomService.MoveQueue(ctx, roomID, req.DestinationRoomID, req.CounterID, req.QueueNumber)
+	if code := capacityErrorCode(err); code != "" {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+		c.Data["json"] = map[string]string{
+			"error":       "Destination room is full",
+			"code":        code,
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
 	if err != nil {
 		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
 		c.Data["json"] = map[string]string{
@@ -211,6 +372,26 @@ func (c *RoomController) CallRoomQueue() {
 	c.ServeJSON()
 }
 
+// ListRooms returns all rooms with remaining capacity, so dispenser can disable rooms which are full
+func (c *RoomController) ListRooms() {
+	rooms, err := RoomService.ListRooms(c.Ctx.Request.Context())
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to list rooms",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = map[string]interface{}{
+		"rooms": rooms,
+	}
+	c.ServeJSON()
+}
+
 func (c *RoomController) GetRoomQueues() {
 	ctx := c.Ctx.Request.Context()
 	roomID := c.Ctx.Input.Param(":id")
@@ -238,6 +419,17 @@ func (c *RoomController) GetRoomQueues() {
 		return
 	}
 
+	wait, err := RoomService.GetRoomWaitEstimate(ctx, roomID)
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to estimate wait",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
 	c.Ctx.Output.SetStatus(http.StatusOK)
 	c.Data["json"] = map[string]interface{}{
 		"details": map[string]interface{}{
@@ -246,6 +438,7 @@ func (c *RoomController) GetRoomQueues() {
 			"counters":  counters,
 		},
 		"queues": queues,
+		"wait":   wait,
 	}
 	c.ServeJSON()
 }
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/services"
+)
+
+type TicketController struct {
+	web.Controller
+}
+
+// GetTicketStatus returns current room, position and estimated wait of a ticket.
+// It's public for ticket holders, so it's rate limited per client IP.
+func (c *TicketController) GetTicketStatus() {
+	ctx := c.Ctx.Request.Context()
+	number := c.Ctx.Input.Param(":number")
+
+	isAllowed, retryAfter := TicketService.AllowLookup(ctx, clientIP(c.Ctx))
+	if !isAllowed {
+		c.Ctx.Output.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.Ctx.Output.SetStatus(http.StatusTooManyRequests)
+		c.Data["json"] = map[string]string{
+			"error":       "Too many requests, please try again later",
+			"dev_message": "ticket lookup rate limit exceeded",
+		}
+		c.ServeJSON()
+		return
+	}
+
+	ticket, err := TicketService.GetStatus(ctx, number)
+	if errors.Is(err, services.ErrTicketNotFound) {
+		// finished tickets are no longer in any queue
+		c.Ctx.Output.SetStatus(http.StatusNotFound)
+		c.Data["json"] = map[string]string{
+			"error":       "Ticket not found or already served",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+	if err != nil {
+		c.Ctx.Output.SetStatus(http.StatusInternalServerError)
+		c.Data["json"] = map[string]string{
+			"error":       "Failed to get ticket status",
+			"dev_message": err.Error(),
+		}
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Data["json"] = ticket
+	c.ServeJSON()
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/gorilla/websocket"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+var upgrader = websocket.Upgrader{
+	// same as SSE, which allows any origin
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+const (
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+	wsActionCall        = "call"
+	wsActionCallNext    = "call_next"
+	wsActionRecall      = "recall"
+)
+
+type wsCommand struct {
+	Action string `json:"action"`
+	// echoed in result so client can match it with the command
+	RequestID string `json:"request_id"`
+
+	RoomID      string `json:"room_id"`
+	LastEventID string `json:"last_event_id"`
+	CounterID   string `json:"counter_id"`
+	QueueNumber string `json:"queue_number"`
+}
+
+type wsCommandResult struct {
+	RequestID   string `json:"request_id"`
+	Action      string `json:"action"`
+	QueueNumber string `json:"queue_number,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// StreamRoomEventsWS streams room events over WebSocket, in the same format as SSE.
+// Client is subscribed to :id, and may subscribe to more rooms or send commands over the socket.
+func (c *RoomController) StreamRoomEventsWS() {
+	ctx := c.Ctx.Request.Context()
+	roomID := c.Ctx.Input.Param(":id")
+	lastEventID := c.Ctx.Input.Query("last_event_id")
+
+	conn, err := upgrader.Upgrade(c.Ctx.ResponseWriter, c.Ctx.Request, nil)
+	if err != nil {
+		// upgrader already replied with error
+		logs.Error("fail to upgrade websocket connection: %s", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	client := EventHubService.NewClient(newClientInfo(c.Ctx, models.ClientTransportWS), models.NewWSTransport(conn))
+	subscribeRoom(ctx, client, roomID, lastEventID)
+
+	go readCommands(ctx, conn, client)
+
+	// blocks until client disconnects or is evicted
+	client.WritePump(ctx)
+	EventHubService.UnsubscribeAll(client)
+}
+
+// readCommands reads commands until connection is closed. Results are queued to the client like events.
+func readCommands(ctx context.Context, conn *websocket.Conn, client *models.Client) {
+	// hijacked connection is not tracked by request context, so stop the client once read fails
+	defer client.Close()
+
+	conn.SetReadLimit(4096)
+	for {
+		var cmd wsCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				logs.Info("fail to read command from client %s: %s", client.ID, err.Error())
+			}
+			return
+		}
+
+		result := wsCommandResult{
+			RequestID: cmd.RequestID,
+			Action:    cmd.Action,
+		}
+
+		queueNumber, err := doCommand(ctx, client, cmd)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.QueueNumber = queueNumber
+
+		event, err := models.NewEvent(models.EventCommandResult, result)
+		if err != nil {
+			logs.Error("fail to create command result event: %s", err.Error())
+			continue
+		}
+		client.Enqueue(cmd.RoomID, event)
+	}
+}
+
+// doCommand runs command with the same validation as REST handlers
+func doCommand(ctx context.Context, client *models.Client, cmd wsCommand) (string, error) {
+	switch cmd.Action {
+	case wsActionSubscribe:
+		if cmd.RoomID != models.InternalRoomIDDisplay {
+			if _, err := RoomService.GetRoom(ctx, cmd.RoomID); err != nil {
+				return "", err
+			}
+		}
+		subscribeRoom(ctx, client, cmd.RoomID, cmd.LastEventID)
+		return "", nil
+
+	case wsActionUnsubscribe:
+		EventHubService.Unsubscribe(cmd.RoomID, client)
+		return "", nil
+
+	case wsActionCall:
+		return cmd.QueueNumber, CallService.AddCallJob(ctx, models.CallJob{
+			RoomID:      cmd.RoomID,
+			CounterID:   cmd.CounterID,
+			QueueNumber: cmd.QueueNumber,
+		})
+
+	case wsActionCallNext:
+		return CallService.CallNext(ctx, cmd.RoomID, cmd.CounterID)
+
+	case wsActionRecall:
+		return CallService.Recall(ctx, cmd.RoomID, cmd.CounterID)
+	}
+
+	return "", errors.New("invalid action")
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+const (
+	announcementKey    = "announcements"
+	announcementSeqKey = "announcements:seq"
+	// announcement id -> announcement, as last pushed to displays by any instance
+	announcementPushedKey = "announcements:pushed"
+)
+
+// Announcement is message shown on displays, e.g. "Pharmacy closes at 21:00"
+type Announcement struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	ImageURL string `json:"image_url,omitempty"`
+	// empty means all rooms
+	RoomIDs []string `json:"room_ids,omitempty"`
+	// zero start means immediately, zero end means until deleted
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+	// higher priority is shown first
+	Priority  int       `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (a Announcement) Validate() error {
+	if a.Text == "" && a.ImageURL == "" {
+		return errors.New("text or image is required")
+	}
+	if !a.EndAt.IsZero() && !a.EndAt.After(a.StartAt) {
+		return errors.New("end time must be after start time")
+	}
+	return nil
+}
+
+func (a Announcement) IsActive(now time.Time) bool {
+	if !a.StartAt.IsZero() && now.Before(a.StartAt) {
+		return false
+	}
+	if !a.EndAt.IsZero() && !now.Before(a.EndAt) {
+		return false
+	}
+	return true
+}
+
+func (a Announcement) IsTargeting(roomID string) bool {
+	return len(a.RoomIDs) == 0 || slices.Contains(a.RoomIDs, roomID)
+}
+
+// AnnouncementStore stores announcements in redis hash, announcement id -> announcement
+type AnnouncementStore struct{}
+
+func NewAnnouncementStore() *AnnouncementStore {
+	return &AnnouncementStore{}
+}
+
+func (as *AnnouncementStore) Create(ctx context.Context, a Announcement) (Announcement, error) {
+	id, err := databases.RedisClient.Incr(ctx, announcementSeqKey).Result()
+	if err != nil {
+		return Announcement{}, err
+	}
+	a.ID = strconv.FormatInt(id, 10)
+	a.CreatedAt = time.Now()
+
+	astr, err := json.Marshal(a)
+	if err != nil {
+		return Announcement{}, err
+	}
+
+	if err := databases.RedisClient.HSet(ctx, announcementKey, a.ID, astr).Err(); err != nil {
+		return Announcement{}, err
+	}
+
+	return a, nil
+}
+
+// List returns all announcements, sorted by priority then creation time
+func (as *AnnouncementStore) List(ctx context.Context) ([]Announcement, error) {
+	res, err := databases.RedisClient.HGetAll(ctx, announcementKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	announcements := make([]Announcement, 0, len(res))
+	for _, astr := range res {
+		var a Announcement
+		if err := json.Unmarshal([]byte(astr), &a); err != nil {
+			logs.Error("failed to unmarshal announcement: %s", err.Error())
+			continue
+		}
+		announcements = append(announcements, a)
+	}
+
+	slices.SortFunc(announcements, func(a, b Announcement) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return announcements, nil
+}
+
+func (as *AnnouncementStore) Delete(ctx context.Context, id string) error {
+	n, err := databases.RedisClient.HDel(ctx, announcementKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("announcement not found")
+	}
+	return nil
+}
+
+// ListPushed returns announcements last pushed as activated, by id. Announcements can't be edited, so id
+// is enough to tell whether the announcement was pushed.
+func (as *AnnouncementStore) ListPushed(ctx context.Context) (map[string]Announcement, error) {
+	res, err := databases.RedisClient.HGetAll(ctx, announcementPushedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pushed := make(map[string]Announcement, len(res))
+	for id, astr := range res {
+		var a Announcement
+		if err := json.Unmarshal([]byte(astr), &a); err != nil {
+			logs.Error("failed to unmarshal pushed announcement: %s", err.Error())
+			continue
+		}
+		pushed[id] = a
+	}
+	return pushed, nil
+}
+
+// SetPushed records announcement as pushed as activated, or as expired if isActive is false
+func (as *AnnouncementStore) SetPushed(ctx context.Context, a Announcement, isActive bool) error {
+	if !isActive {
+		return databases.RedisClient.HDel(ctx, announcementPushedKey, a.ID).Err()
+	}
+
+	astr, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return databases.RedisClient.HSet(ctx, announcementPushedKey, a.ID, astr).Err()
+}
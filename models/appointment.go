@@ -0,0 +1,316 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+const (
+	// how far ahead a slot can be booked
+	appointmentMaxDaysAhead = 30
+	// booking code alphabet, without look-alike characters so it can be read over the phone
+	appointmentCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	appointmentCodeLength   = 6
+)
+
+var (
+	ErrAppointmentDisabled  = errors.New("room doesn't accept appointments")
+	ErrAppointmentNotFound  = errors.New("appointment not found")
+	ErrAppointmentCheckedIn = errors.New("appointment is already checked in")
+	// appointment can only be checked in on the business day of its slot
+	ErrAppointmentNotToday = errors.New("appointment is not for today")
+	ErrInvalidSlot         = errors.New("invalid appointment slot")
+	ErrSlotFull            = errors.New("appointment slot is full")
+)
+
+// AppointmentConfig is how a room accepts appointments. Room without slot minutes doesn't accept appointments.
+type AppointmentConfig struct {
+	// slots start every this many minutes from midnight
+	SlotMinutes int `json:"slot_minutes"`
+	// bookings per slot, default to 1
+	SlotCapacity int `json:"slot_capacity"`
+	// check-in this many minutes around the slot goes ahead of walk-ins, default to 15.
+	// check-in outside the window queues like a walk-in.
+	GraceMinutes int `json:"grace_minutes"`
+}
+
+// Appointment is a booked slot. Once checked in, it becomes a ticket in room main queue.
+type Appointment struct {
+	QueueInfo
+	Code     string    `json:"code"`
+	RoomID   string    `json:"room_id"`
+	SlotAt   time.Time `json:"slot_at"`
+	BookedAt time.Time `json:"booked_at"`
+	// set once checked in
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+	QueueNumber string     `json:"queue_number,omitempty"`
+}
+
+// AppointmentBook keeps appointments of a room
+type AppointmentBook struct {
+	AppointmentConfig
+	roomID string
+}
+
+func NewAppointmentBook(roomID string, cfg AppointmentConfig) *AppointmentBook {
+	return &AppointmentBook{
+		AppointmentConfig: cfg,
+		roomID:            roomID,
+	}
+}
+
+func (c AppointmentConfig) IsEnabled() bool {
+	return c.SlotMinutes > 0
+}
+
+func (c AppointmentConfig) withDefaults() AppointmentConfig {
+	if c.SlotCapacity == 0 {
+		c.SlotCapacity = 1
+	}
+	if c.GraceMinutes == 0 {
+		c.GraceMinutes = 15
+	}
+	return c
+}
+
+func (c AppointmentConfig) Validate() error {
+	if c.SlotMinutes < 0 || c.SlotCapacity < 0 || c.GraceMinutes < 0 {
+		return errors.New("appointments config must not be negative")
+	}
+	return nil
+}
+
+// IsOnTime returns whether check-in at now is within grace window of the slot
+func (c AppointmentConfig) IsOnTime(slotAt, now time.Time) bool {
+	grace := time.Duration(c.GraceMinutes) * time.Minute
+	return !now.Before(slotAt.Add(-grace)) && !now.After(slotAt.Add(grace))
+}
+
+// Book reserves the slot. Slot must start on a slot boundary, in the future, and within opening hours.
+func (ab *AppointmentBook) Book(ctx context.Context, hours OpeningHours, info QueueInfo, slotAt time.Time) (Appointment, error) {
+	if !ab.IsEnabled() {
+		return Appointment{}, ErrAppointmentDisabled
+	}
+	if err := ab.validateSlot(hours, slotAt); err != nil {
+		return Appointment{}, err
+	}
+
+	listKey := ab.getListKey(slotAt)
+	score := strconv.FormatInt(slotAt.Unix(), 10)
+
+	// like queue sequence, concurrent booking of the last seat may overbook the slot
+	booked, err := databases.RedisClient.ZCount(ctx, listKey, score, score).Result()
+	if err != nil {
+		return Appointment{}, err
+	}
+	if booked >= int64(ab.SlotCapacity) {
+		return Appointment{}, ErrSlotFull
+	}
+
+	appointment := Appointment{
+		QueueInfo: info,
+		RoomID:    ab.roomID,
+		SlotAt:    slotAt,
+		BookedAt:  time.Now(),
+	}
+	if err := ab.create(ctx, &appointment); err != nil {
+		return Appointment{}, err
+	}
+
+	expireAt := getAppointmentExpireAt(slotAt)
+	if err := databases.RedisClient.ZAdd(ctx, listKey, redis.Z{
+		Score:  float64(slotAt.Unix()),
+		Member: appointment.Code,
+	}).Err(); err != nil {
+		return Appointment{}, err
+	}
+	databases.RedisClient.ExpireAt(ctx, listKey, expireAt)
+
+	return appointment, nil
+}
+
+func (ab *AppointmentBook) validateSlot(hours OpeningHours, slotAt time.Time) error {
+	local := slotAt.In(businessLoc)
+	if local.Second() != 0 || local.Nanosecond() != 0 || (local.Hour()*60+local.Minute())%ab.SlotMinutes != 0 {
+		return fmt.Errorf("%w: must start every %d minutes", ErrInvalidSlot, ab.SlotMinutes)
+	}
+
+	now := time.Now()
+	if !slotAt.After(now) {
+		return fmt.Errorf("%w: must be in the future", ErrInvalidSlot)
+	}
+	if slotAt.After(now.AddDate(0, 0, appointmentMaxDaysAhead)) {
+		return fmt.Errorf("%w: must be within %d days", ErrInvalidSlot, appointmentMaxDaysAhead)
+	}
+	if !hours.Status(slotAt).IsOpen {
+		return fmt.Errorf("%w: room is closed", ErrInvalidSlot)
+	}
+
+	return nil
+}
+
+// create stores the appointment under a new unique code
+func (ab *AppointmentBook) create(ctx context.Context, appointment *Appointment) error {
+	expiration := time.Until(getAppointmentExpireAt(appointment.SlotAt))
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := newAppointmentCode()
+		if err != nil {
+			return err
+		}
+		appointment.Code = code
+
+		appointmentstr, err := json.Marshal(appointment)
+		if err != nil {
+			return err
+		}
+
+		isCreated, err := databases.RedisClient.SetNX(ctx, getAppointmentKey(code), appointmentstr, expiration).Result()
+		if err != nil {
+			return err
+		}
+		if isCreated {
+			return nil
+		}
+	}
+
+	return errors.New("failed to generate unique appointment code")
+}
+
+// List returns appointments of the business day, by slot
+func (ab *AppointmentBook) List(ctx context.Context, date time.Time) ([]Appointment, error) {
+	codes, err := databases.RedisClient.ZRange(ctx, ab.getListKey(date), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	appointments := []Appointment{}
+	for _, code := range codes {
+		appointment, err := GetAppointment(ctx, code)
+		if errors.Is(err, ErrAppointmentNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, appointment)
+	}
+
+	return appointments, nil
+}
+
+// ClaimCheckIn marks appointment as being checked in, so the same code can't be checked in twice.
+// Release the claim if the ticket fails to be created.
+func (ab *AppointmentBook) ClaimCheckIn(ctx context.Context, appointment Appointment) error {
+	isClaimed, err := databases.RedisClient.SetNX(ctx, getAppointmentKey(appointment.Code)+":check_in", 1,
+		time.Until(getAppointmentExpireAt(appointment.SlotAt))).Result()
+	if err != nil {
+		return err
+	}
+	if !isClaimed {
+		return ErrAppointmentCheckedIn
+	}
+	return nil
+}
+
+func (ab *AppointmentBook) ReleaseCheckIn(ctx context.Context, appointment Appointment) error {
+	return databases.RedisClient.Del(ctx, getAppointmentKey(appointment.Code)+":check_in").Err()
+}
+
+// CompleteCheckIn records the ticket issued for the appointment. Priority tickets are kept
+// so later on time check-ins are placed after them, but still ahead of walk-ins.
+func (ab *AppointmentBook) CompleteCheckIn(ctx context.Context, appointment Appointment, queueNumber string, isPriority bool) (Appointment, error) {
+	now := time.Now()
+	appointment.CheckedInAt = &now
+	appointment.QueueNumber = queueNumber
+
+	appointmentstr, err := json.Marshal(appointment)
+	if err != nil {
+		return Appointment{}, err
+	}
+	if err := databases.RedisClient.Set(ctx, getAppointmentKey(appointment.Code), appointmentstr, redis.KeepTTL).Err(); err != nil {
+		return Appointment{}, err
+	}
+
+	if isPriority {
+		key := ab.getPriorityKey()
+		if err := databases.RedisClient.SAdd(ctx, key, queueNumber).Err(); err != nil {
+			return Appointment{}, err
+		}
+		databases.RedisClient.Expire(ctx, key, 18*time.Hour)
+	}
+
+	return appointment, nil
+}
+
+// IsPriority returns which of the queue numbers were checked in on time today
+func (ab *AppointmentBook) IsPriority(ctx context.Context, queueNumbers []string) ([]bool, error) {
+	if len(queueNumbers) == 0 {
+		return nil, nil
+	}
+
+	members := make([]interface{}, len(queueNumbers))
+	for i, number := range queueNumbers {
+		members[i] = number
+	}
+	return databases.RedisClient.SMIsMember(ctx, ab.getPriorityKey(), members...).Result()
+}
+
+// appointments:{room id}:{YYYYMMDD} is sorted set of booking codes by slot time
+func (ab *AppointmentBook) getListKey(date time.Time) string {
+	return fmt.Sprintf("appointments:%s:%s", ab.roomID, businessDayKey(date))
+}
+
+// appointments:{room id}:{YYYYMMDD}:priority is set of queue numbers checked in on time today
+func (ab *AppointmentBook) getPriorityKey() string {
+	return ab.getListKey(time.Now()) + ":priority"
+}
+
+// GetAppointment returns appointment of the booking code, of any room
+func GetAppointment(ctx context.Context, code string) (Appointment, error) {
+	// code is printed upper case, but may be typed in any case
+	appointmentstr, err := databases.RedisClient.Get(ctx, getAppointmentKey(strings.ToUpper(code))).Bytes()
+	if err == redis.Nil {
+		return Appointment{}, ErrAppointmentNotFound
+	}
+	if err != nil {
+		return Appointment{}, err
+	}
+
+	var appointment Appointment
+	if err := json.Unmarshal(appointmentstr, &appointment); err != nil {
+		return Appointment{}, err
+	}
+	return appointment, nil
+}
+
+func getAppointmentKey(code string) string {
+	return fmt.Sprintf("appointment:%s", code)
+}
+
+// appointment is kept until the day after its business day, so front desk can still look it up
+func getAppointmentExpireAt(slotAt time.Time) time.Time {
+	return BusinessDate(slotAt).AddDate(0, 0, 2)
+}
+
+func newAppointmentCode() (string, error) {
+	code := make([]byte, appointmentCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(appointmentCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = appointmentCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
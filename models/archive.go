@@ -0,0 +1,291 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const archiveDateLayout = "2006-01-02"
+
+// ArchiveStore keeps finished days in an embedded SQLite file, after they're removed from redis
+type ArchiveStore struct {
+	db *sql.DB
+}
+
+// ArchivedDay is all data of a day copied from redis
+type ArchivedDay struct {
+	Date    time.Time
+	Tickets []ArchivedTicket
+	// queue number -> journey, oldest first
+	Journeys map[string][]TicketJourneyEntry
+	// room id -> call logs, oldest first
+	CallLogs map[string][]CallJob
+}
+
+// ArchivedTicket is a ticket and where it was when the day was archived
+type ArchivedTicket struct {
+	QueueInfo
+	Number     string       `json:"number"`
+	RoomID     string       `json:"room_id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastAction TicketAction `json:"last_action"`
+	LastRoomID string       `json:"last_room_id"`
+	LastQueue  string       `json:"last_queue"`
+	LastAt     time.Time    `json:"last_at"`
+}
+
+type ArchivedDaySummary struct {
+	Date       string    `json:"date"`
+	Tickets    int       `json:"tickets"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+var archiveSchema = []string{
+	`CREATE TABLE IF NOT EXISTS archived_days (
+		date        TEXT PRIMARY KEY,
+		archived_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS tickets (
+		date         TEXT NOT NULL,
+		number       TEXT NOT NULL,
+		room_id      TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		phone        TEXT NOT NULL,
+		created_at   TEXT NOT NULL,
+		last_action  TEXT NOT NULL,
+		last_room_id TEXT NOT NULL,
+		last_queue   TEXT NOT NULL,
+		last_at      TEXT NOT NULL,
+		PRIMARY KEY (date, number)
+	)`,
+	`CREATE TABLE IF NOT EXISTS journeys (
+		date         TEXT NOT NULL,
+		number       TEXT NOT NULL,
+		seq          INTEGER NOT NULL,
+		action       TEXT NOT NULL,
+		room_id      TEXT NOT NULL,
+		from_room_id TEXT NOT NULL,
+		queue        TEXT NOT NULL,
+		counter_id   TEXT NOT NULL,
+		actor        TEXT NOT NULL,
+		timestamp    TEXT NOT NULL,
+		PRIMARY KEY (date, number, seq)
+	)`,
+	`CREATE TABLE IF NOT EXISTS call_logs (
+		date         TEXT NOT NULL,
+		room_id      TEXT NOT NULL,
+		seq          INTEGER NOT NULL,
+		room_name    TEXT NOT NULL,
+		counter_id   TEXT NOT NULL,
+		counter_name TEXT NOT NULL,
+		queue_number TEXT NOT NULL,
+		called_at    TEXT NOT NULL,
+		PRIMARY KEY (date, room_id, seq)
+	)`,
+}
+
+func NewArchiveStore(path string) (*ArchiveStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, serialize instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range archiveSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &ArchiveStore{
+		db: db,
+	}, nil
+}
+
+// Save stores the day. Rows of a day archived before are replaced.
+func (as *ArchiveStore) Save(ctx context.Context, day ArchivedDay) error {
+	date := BusinessDate(day.Date).Format(archiveDateLayout)
+
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range day.Tickets {
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO tickets
+			(date, number, room_id, name, phone, created_at, last_action, last_room_id, last_queue, last_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			date, t.Number, t.RoomID, t.Name, t.Phone, formatArchiveTime(t.CreatedAt),
+			string(t.LastAction), t.LastRoomID, t.LastQueue, formatArchiveTime(t.LastAt),
+		); err != nil {
+			return err
+		}
+	}
+
+	for number, entries := range day.Journeys {
+		for i, e := range entries {
+			if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO journeys
+				(date, number, seq, action, room_id, from_room_id, queue, counter_id, actor, timestamp)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				date, number, i, string(e.Action), e.RoomID, e.FromRoomID, e.Queue, e.CounterID, e.Actor,
+				formatArchiveTime(e.Timestamp),
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	for roomID, jobs := range day.CallLogs {
+		for i, job := range jobs {
+			if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO call_logs
+				(date, room_id, seq, room_name, counter_id, counter_name, queue_number, called_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				date, roomID, i, job.RoomName, job.CounterID, job.CounterName, job.QueueNumber,
+				formatArchiveTime(job.CalledAt),
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO archived_days (date, archived_at) VALUES (?, ?)`,
+		date, formatArchiveTime(time.Now()),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (as *ArchiveStore) IsArchived(ctx context.Context, date time.Time) (bool, error) {
+	var n int
+	err := as.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM archived_days WHERE date = ?`,
+		BusinessDate(date).Format(archiveDateLayout),
+	).Scan(&n)
+	return n > 0, err
+}
+
+// ListDays returns archived days, newest first
+func (as *ArchiveStore) ListDays(ctx context.Context) ([]ArchivedDaySummary, error) {
+	rows, err := as.db.QueryContext(ctx, `SELECT d.date, d.archived_at, COUNT(t.number)
+		FROM archived_days d LEFT JOIN tickets t ON t.date = d.date
+		GROUP BY d.date, d.archived_at
+		ORDER BY d.date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []ArchivedDaySummary{}
+	for rows.Next() {
+		var day ArchivedDaySummary
+		var archivedAt string
+		if err := rows.Scan(&day.Date, &archivedAt, &day.Tickets); err != nil {
+			return nil, err
+		}
+		day.ArchivedAt = parseArchiveTime(archivedAt)
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// ListTickets returns tickets of the day, by creation time
+func (as *ArchiveStore) ListTickets(ctx context.Context, date time.Time) ([]ArchivedTicket, error) {
+	rows, err := as.db.QueryContext(ctx, `SELECT number, room_id, name, phone, created_at, last_action, last_room_id, last_queue, last_at
+		FROM tickets WHERE date = ? ORDER BY created_at, number`,
+		BusinessDate(date).Format(archiveDateLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []ArchivedTicket{}
+	for rows.Next() {
+		var t ArchivedTicket
+		var createdAt, lastAction, lastAt string
+		if err := rows.Scan(&t.Number, &t.RoomID, &t.Name, &t.Phone, &createdAt, &lastAction, &t.LastRoomID, &t.LastQueue, &lastAt); err != nil {
+			return nil, err
+		}
+		t.CreatedAt = parseArchiveTime(createdAt)
+		t.LastAction = TicketAction(lastAction)
+		t.LastAt = parseArchiveTime(lastAt)
+		tickets = append(tickets, t)
+	}
+	return tickets, rows.Err()
+}
+
+// GetJourneys returns journey of all tickets of the day, by queue number. Empty number returns all tickets.
+func (as *ArchiveStore) GetJourneys(ctx context.Context, date time.Time, number string) (map[string][]TicketJourneyEntry, error) {
+	rows, err := as.db.QueryContext(ctx, `SELECT number, action, room_id, from_room_id, queue, counter_id, actor, timestamp
+		FROM journeys WHERE date = ? AND (? = '' OR number = ?) ORDER BY number, seq`,
+		BusinessDate(date).Format(archiveDateLayout), number, number,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	journeys := make(map[string][]TicketJourneyEntry)
+	for rows.Next() {
+		var e TicketJourneyEntry
+		var action, timestamp string
+		if err := rows.Scan(&e.Number, &action, &e.RoomID, &e.FromRoomID, &e.Queue, &e.CounterID, &e.Actor, &timestamp); err != nil {
+			return nil, err
+		}
+		e.Action = TicketAction(action)
+		e.Timestamp = parseArchiveTime(timestamp)
+		journeys[e.Number] = append(journeys[e.Number], e)
+	}
+	return journeys, rows.Err()
+}
+
+// GetCallLogs returns call logs of the day, by room id
+func (as *ArchiveStore) GetCallLogs(ctx context.Context, date time.Time) (map[string][]CallJob, error) {
+	rows, err := as.db.QueryContext(ctx, `SELECT room_id, room_name, counter_id, counter_name, queue_number, called_at
+		FROM call_logs WHERE date = ? ORDER BY room_id, seq`,
+		BusinessDate(date).Format(archiveDateLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	callLogs := make(map[string][]CallJob)
+	for rows.Next() {
+		var job CallJob
+		var calledAt string
+		if err := rows.Scan(&job.RoomID, &job.RoomName, &job.CounterID, &job.CounterName, &job.QueueNumber, &calledAt); err != nil {
+			return nil, err
+		}
+		job.CalledAt = parseArchiveTime(calledAt)
+		callLogs[job.RoomID] = append(callLogs[job.RoomID], job)
+	}
+	return callLogs, rows.Err()
+}
+
+func formatArchiveTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseArchiveTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+// day keyed redis data, the date is always the last key segment
+var dayKeyPatterns = []string{
+	"queue:*",            // queue:{queue id}:{date}
+	"call_log:*",         // call_log:{room id}:{date}
+	"ticket:*:journey:*", // ticket:{queue number}:journey:{date}
+	"ticket_journey:*",   // ticket_journey:{date}
+}
+
+// ListRedisDates returns business days before the given business day which still have data in redis, oldest first
+func ListRedisDates(ctx context.Context, before time.Time) ([]time.Time, error) {
+	beforeDay := businessDayKey(before)
+
+	days := make(map[string]bool)
+	for _, pattern := range dayKeyPatterns {
+		keys, err := scanKeys(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			day := key[strings.LastIndex(key, ":")+1:]
+			if day < beforeDay {
+				days[day] = true
+			}
+		}
+	}
+
+	var dates []time.Time
+	for day := range days {
+		date, err := parseBusinessDate("20060102", day)
+		if err != nil {
+			// not a day keyed key, e.g. queue:{queue number}:info
+			continue
+		}
+		dates = append(dates, date)
+	}
+	slices.SortFunc(dates, func(a, b time.Time) int {
+		return a.Compare(b)
+	})
+
+	return dates, nil
+}
+
+// CollectDay reads all data of the date from redis. It also returns the keys read, to be deleted once archived.
+//
+// Queue info and sequence keys are not returned since they expire by themselves. Info is keyed by
+// queue number only, so it may already belong to a ticket of the next day, ticket info is taken
+// from its create journey entry instead.
+func CollectDay(ctx context.Context, date time.Time) (ArchivedDay, []string, error) {
+	date = BusinessDate(date)
+	day := date.Format("20060102")
+	archived := ArchivedDay{
+		Date:     date,
+		CallLogs: make(map[string][]CallJob),
+	}
+	var keys []string
+
+	journeys, err := ListTicketJourneysByDate(ctx, date)
+	if err != nil {
+		return ArchivedDay{}, nil, err
+	}
+	archived.Journeys = journeys
+	keys = append(keys, getJourneyLogKey(date))
+
+	journeyKeys, err := scanKeys(ctx, "ticket:*:journey:"+day)
+	if err != nil {
+		return ArchivedDay{}, nil, err
+	}
+	keys = append(keys, journeyKeys...)
+
+	callLogKeys, err := scanKeys(ctx, "call_log:*:"+day)
+	if err != nil {
+		return ArchivedDay{}, nil, err
+	}
+	for _, key := range callLogKeys {
+		jobs, err := listCallLogs(ctx, key, 0)
+		if err != nil {
+			return ArchivedDay{}, nil, err
+		}
+		roomID := strings.TrimSuffix(strings.TrimPrefix(key, "call_log:"), ":"+day)
+		archived.CallLogs[roomID] = jobs
+	}
+	keys = append(keys, callLogKeys...)
+
+	tickets := make(map[string]*ArchivedTicket)
+	for number, entries := range journeys {
+		tickets[number] = newArchivedTicket(number, entries)
+	}
+
+	// tickets left in queue, either unfinished or created before journey was recorded
+	queueKeys, err := scanKeys(ctx, "queue:*:"+day)
+	if err != nil {
+		return ArchivedDay{}, nil, err
+	}
+	for _, key := range queueKeys {
+		numbers, err := databases.RedisClient.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return ArchivedDay{}, nil, err
+		}
+
+		// queue id is {room id}:main, {room id}:skip or {room id}:counter:{counter id}
+		queueID := strings.TrimSuffix(strings.TrimPrefix(key, "queue:"), ":"+day)
+		roomID, queue, _ := strings.Cut(queueID, ":")
+		for _, number := range numbers {
+			if _, ok := tickets[number]; ok {
+				continue
+			}
+			tickets[number] = &ArchivedTicket{
+				Number:     number,
+				RoomID:     roomID,
+				LastRoomID: roomID,
+				LastQueue:  queue,
+			}
+		}
+	}
+	keys = append(keys, queueKeys...)
+
+	for _, number := range slices.Sorted(maps.Keys(tickets)) {
+		archived.Tickets = append(archived.Tickets, *tickets[number])
+	}
+
+	return archived, keys, nil
+}
+
+// DeleteDayKeys removes archived keys from redis
+func DeleteDayKeys(ctx context.Context, keys []string) error {
+	// delete in batches, so a single command doesn't block redis for too long
+	for batch := range slices.Chunk(keys, 100) {
+		if err := databases.RedisClient.Del(ctx, batch...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newArchivedTicket(number string, entries []TicketJourneyEntry) *ArchivedTicket {
+	first := entries[0]
+	last := entries[len(entries)-1]
+
+	ticket := &ArchivedTicket{
+		Number:     number,
+		RoomID:     first.RoomID,
+		LastAction: last.Action,
+		LastRoomID: last.RoomID,
+		LastQueue:  last.Queue,
+		LastAt:     last.Timestamp,
+	}
+	if first.Action == TicketActionCreate {
+		ticket.CreatedAt = first.Timestamp
+		if first.Info != nil {
+			ticket.QueueInfo = *first.Info
+		}
+	}
+	if last.CounterID != "" {
+		ticket.LastQueue = "counter:" + last.CounterID
+	}
+	return ticket
+}
+
+func scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := databases.RedisClient.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// business day decides which day date keyed data belongs to, e.g. queue numbering and call logs.
+// A business day starts at cutover hour in business timezone, so a 24 hours clinic can roll over
+// at its quietest hour instead of at midnight of server timezone.
+var (
+	businessLoc         = time.Local
+	businessCutoverHour int
+)
+
+// InitBusinessDay loads business timezone and cutover hour from config
+func InitBusinessDay() error {
+	if timezone, err := web.AppConfig.String("app::timezone"); err == nil && timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return err
+		}
+		businessLoc = loc
+	}
+
+	cutoverHour, err := web.AppConfig.Int("app::day_cutover_hour")
+	if err != nil || cutoverHour < 0 || cutoverHour > 23 {
+		cutoverHour = 0
+	}
+	businessCutoverHour = cutoverHour
+
+	logs.Info("Business day starts at %02d:00 %s", cutoverHour, businessLoc)
+	return nil
+}
+
+// BusinessLocation returns business timezone
+func BusinessLocation() *time.Location {
+	return businessLoc
+}
+
+// BusinessDate returns the business day t belongs to, as the time the business day starts.
+// Since the start belongs to its own business day, BusinessDate of a business date returns the same date.
+func BusinessDate(t time.Time) time.Time {
+	year, month, day := t.In(businessLoc).Add(-time.Duration(businessCutoverHour) * time.Hour).Date()
+	return newBusinessDate(year, month, day)
+}
+
+// BusinessToday returns the current business day
+func BusinessToday() time.Time {
+	return BusinessDate(time.Now())
+}
+
+// ParseBusinessDate parses YYYY-MM-DD as a business day
+func ParseBusinessDate(value string) (time.Time, error) {
+	return parseBusinessDate("2006-01-02", value)
+}
+
+func parseBusinessDate(layout, value string) (time.Time, error) {
+	date, err := time.ParseInLocation(layout, value, businessLoc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return newBusinessDate(date.Date()), nil
+}
+
+func newBusinessDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, businessCutoverHour, 0, 0, 0, businessLoc)
+}
+
+// businessDayKey formats business day of t as date segment of redis keys
+func businessDayKey(t time.Time) string {
+	return BusinessDate(t).Format("20060102")
+}
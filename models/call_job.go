@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/beego/beego/v2/core/logs"
@@ -33,7 +34,8 @@ type CallJob struct {
 	CounterName string
 	QueueNumber string
 
-	CalledAt time.Time
+	EnqueuedAt time.Time
+	CalledAt   time.Time
 }
 
 func NewCallQueue(id string) (*CallQueue, error) {
@@ -69,6 +71,7 @@ func (cq *CallQueue) Addjob(ctx context.Context, job *CallJob) error {
 			"counter_name": job.CounterName,
 			"counter_id":   job.CounterID,
 			"queue_number": job.QueueNumber,
+			"enqueued_at":  time.Now().UnixMilli(),
 		},
 	}).Err()
 }
@@ -96,6 +99,7 @@ func (cq *CallQueue) GetCallJobs(ctx context.Context) ([]CallJob, error) {
 			CounterName: getValues(values, "counter_name"),
 			CounterID:   getValues(values, "counter_id"),
 			QueueNumber: getValues(values, "queue_number"),
+			EnqueuedAt:  getTimeValues(values, "enqueued_at"),
 		})
 	}
 
@@ -114,6 +118,30 @@ func getValues(values map[string]interface{}, key string) string {
 	return vv
 }
 
+// getTimeValues parses unix millisecond value. It returns zero time if value is missing, e.g. job enqueued by older version.
+func getTimeValues(values map[string]interface{}, key string) time.Time {
+	ms, err := strconv.ParseInt(getValues(values, key), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// CountPending returns number of jobs not yet done, both undelivered and delivered but not acknowledged
+func (cq *CallQueue) CountPending(ctx context.Context) (int64, error) {
+	groups, err := databases.RedisClient.XInfoGroups(ctx, cq.stream).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, group := range groups {
+		if group.Name == cq.worker {
+			return group.Pending + max(group.Lag, 0), nil
+		}
+	}
+	return 0, nil
+}
+
 func (cq *CallQueue) Done(ctx context.Context, job *CallJob) error {
 	return databases.RedisClient.XAck(ctx, cq.stream, cq.worker, job.ID).Err()
 }
@@ -131,8 +159,15 @@ func (cq *CallQueue) Log(ctx context.Context, job *CallJob) error {
 }
 
 func (cq *CallQueue) ListLogs(ctx context.Context, roomID string, lastN int64) ([]CallJob, error) {
-	logKey := getLogKey(roomID)
+	return cq.ListLogsByDate(ctx, roomID, BusinessToday(), lastN)
+}
 
+// ListLogsByDate returns call logs of the room on the business day. lastN <= 0 returns all logs.
+func (cq *CallQueue) ListLogsByDate(ctx context.Context, roomID string, date time.Time, lastN int64) ([]CallJob, error) {
+	return listCallLogs(ctx, getLogKeyByDate(roomID, date), lastN)
+}
+
+func listCallLogs(ctx context.Context, logKey string, lastN int64) ([]CallJob, error) {
 	var res *redis.StringSliceCmd
 	if lastN <= 0 {
 		res = databases.RedisClient.LRange(ctx, logKey, 0, -1)
@@ -160,5 +195,10 @@ func (cq *CallQueue) ListLogs(ctx context.Context, roomID string, lastN int64) (
 }
 
 func getLogKey(roomID string) string {
-	return fmt.Sprintf("call_log:%s:%s", roomID, time.Now().Format("20060102"))
+	return getLogKeyByDate(roomID, time.Now())
+}
+
+// getLogKeyByDate returns call log key of business day the date is in
+func getLogKeyByDate(roomID string, date time.Time) string {
+	return fmt.Sprintf("call_log:%s:%s", roomID, businessDayKey(date))
 }
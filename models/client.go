@@ -1,45 +1,301 @@
 package models
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/beego/beego/v2/core/logs"
+	"github.com/gorilla/websocket"
 )
 
+// ClientTransport writes events to a connected client, e.g. SSE or WebSocket.
+// It's only used by Client.WritePump, so it doesn't need to be safe for concurrent use.
+type ClientTransport interface {
+	WriteEvent(event RoomEvent) error
+	// WriteHeartbeat keeps idle connection open and detects dead client by failed write
+	WriteHeartbeat() error
+}
+
+type ClientKind string
+
+const (
+	ClientKindDisplay ClientKind = "display"
+	ClientKindCounter ClientKind = "counter"
+	ClientKindKiosk   ClientKind = "kiosk"
+)
+
+const (
+	ClientTransportSSE = "sse"
+	ClientTransportWS  = "ws"
+)
+
+// ClientInfo is metadata of a connected client, for admin to identify live connections
+type ClientInfo struct {
+	ID          string     `json:"id"`
+	Kind        ClientKind `json:"kind,omitempty"`
+	Transport   string     `json:"transport"`
+	IP          string     `json:"ip"`
+	UserAgent   string     `json:"user_agent"`
+	ConnectedAt time.Time  `json:"connected_at"`
+	LastWriteAt time.Time  `json:"last_write_at"`
+}
+
+// NewClientID generates random client id, for clients which don't identify themselves
+func NewClientID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
 type Client struct {
-	Id string
+	ClientInfo
+	lastWriteAt atomic.Int64 // unix nano, written by WritePump
 
-	writer    io.Writer
-	writerCtl *http.ResponseController
-	Send      chan string
-	Stop      chan struct{}
+	transport ClientTransport
+	send      chan RoomEvent
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// heartbeat is interval of heartbeat written periodically, so proxies don't close
+	// the connection and dead clients are detected by failed write. zero disables it.
+	heartbeat time.Duration
+
+	// events is set of event names the client is interested in. nil means all events
+	events map[string]struct{}
 }
 
-func NewClient(id string, writer http.ResponseWriter) *Client {
+func NewClient(info ClientInfo, transport ClientTransport, bufferSize int, heartbeat time.Duration) *Client {
 	return &Client{
-		Id:   id,
-		Send: make(chan string),
-		Stop: make(chan struct{}),
+		ClientInfo: info,
+		transport:  transport,
+		send:       make(chan RoomEvent, bufferSize),
+		done:       make(chan struct{}),
+		heartbeat:  heartbeat,
+	}
+}
 
-		writer:    writer,
-		writerCtl: http.NewResponseController(writer),
+// Info returns client metadata, safe to be called while WritePump is running
+func (c *Client) Info() ClientInfo {
+	info := c.ClientInfo
+	if lastWrite := c.lastWriteAt.Load(); lastWrite > 0 {
+		info.LastWriteAt = time.Unix(0, lastWrite)
+	}
+	return info
+}
+
+// SetEventFilter limits events written to the client. It must be called before client is subscribed to any room.
+func (c *Client) SetEventFilter(names []string) {
+	if len(names) == 0 {
+		c.events = nil
+		return
+	}
+
+	c.events = make(map[string]struct{}, len(names))
+	for _, name := range names {
+		c.events[name] = struct{}{}
+	}
+}
+
+// Enqueue queues room event to be written to the client without blocking.
+// It returns false if the client is closed or its buffer is full, i.e. the client is too slow.
+// Event filtered out by SetEventFilter is silently skipped.
+func (c *Client) Enqueue(roomID string, event Event) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	if c.events != nil {
+		if _, ok := c.events[event.Name]; !ok {
+			return true
+		}
+	}
+
+	select {
+	case c.send <- RoomEvent{RoomID: roomID, Event: event}:
+		return true
+	default:
+		return false
 	}
 }
 
-// WritePump waits until message is received in send channel, then write to the client via writer.
-// WritePump should be run in a goroutine.
-func (c *Client) WritePump() {
+// Close stops WritePump. It's safe to call multiple times from multiple goroutines.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// Done is closed when client is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// WritePump waits until event is queued, then write to the client via transport.
+// WritePump must be run in the request goroutine, since writer can't be used after the handler returns.
+// It returns when ctx is done, client is closed, or write fails.
+func (c *Client) WritePump(ctx context.Context) {
+	defer c.Close()
+
+	// nil channel blocks forever, i.e. heartbeat disabled
+	var heartbeat <-chan time.Time
+	if c.heartbeat > 0 {
+		ticker := time.NewTicker(c.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
 	for {
+		var err error
 		select {
-		case <-c.Stop:
+		case <-ctx.Done():
+			return
+		case <-c.done:
 			return
-		case message := <-c.Send:
-			if _, err := fmt.Fprint(c.writer, message); err != nil {
-				logs.Info("fail to send message to client ", c.Id)
-			}
-			c.writerCtl.Flush()
+		case event := <-c.send:
+			err = c.transport.WriteEvent(event)
+		case <-heartbeat:
+			err = c.transport.WriteHeartbeat()
+		}
+
+		if err != nil {
+			logs.Info("fail to send message to client %s: %s", c.ID, err.Error())
+			return
+		}
+		c.lastWriteAt.Store(time.Now().UnixNano())
+	}
+}
+
+// SSETransport writes events as server-sent events
+type SSETransport struct {
+	writer    http.ResponseWriter
+	writerCtl *http.ResponseController
+
+	// lastIDs is last event id per room, only for multi room stream
+	lastIDs map[string]uint64
+}
+
+func NewSSETransport(writer http.ResponseWriter) *SSETransport {
+	return &SSETransport{
+		writer:    writer,
+		writerCtl: http.NewResponseController(writer),
+	}
+}
+
+// NewMultiRoomSSETransport creates transport for stream of multiple rooms. Since event ids are per room,
+// event id is combined last event id of all rooms, e.g. "A:12,DISPLAY:3", which is parsed by ParseMultiRoomEventID
+// when client reconnects. Event data is tagged by room, in the same format as WebSocket.
+func NewMultiRoomSSETransport(writer http.ResponseWriter, lastIDs map[string]uint64) *SSETransport {
+	t := NewSSETransport(writer)
+	t.lastIDs = make(map[string]uint64)
+	for roomID, id := range lastIDs {
+		t.lastIDs[roomID] = id
+	}
+	return t
+}
+
+func (t *SSETransport) WriteEvent(event RoomEvent) error {
+	if t.lastIDs == nil {
+		return t.write(event.Format())
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.ID == 0 {
+		return t.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Name, payload))
+	}
+
+	t.lastIDs[event.RoomID] = event.ID
+	return t.write(fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", formatMultiRoomEventID(t.lastIDs), event.Name, payload))
+}
+
+func formatMultiRoomEventID(lastIDs map[string]uint64) string {
+	roomIDs := make([]string, 0, len(lastIDs))
+	for roomID := range lastIDs {
+		roomIDs = append(roomIDs, roomID)
+	}
+	sort.Strings(roomIDs)
+
+	parts := make([]string, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		parts = append(parts, fmt.Sprintf("%s:%d", roomID, lastIDs[roomID]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseMultiRoomEventID parses combined event id written by multi room transport. Invalid parts are ignored.
+func ParseMultiRoomEventID(id string) map[string]uint64 {
+	lastIDs := make(map[string]uint64)
+	for _, part := range strings.Split(id, ",") {
+		roomID, idstr, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
 		}
+		lastID, err := strconv.ParseUint(idstr, 10, 64)
+		if err != nil {
+			continue
+		}
+		lastIDs[roomID] = lastID
+	}
+	return lastIDs
+}
+
+func (t *SSETransport) WriteHeartbeat() error {
+	return t.write(": heartbeat\n\n")
+}
+
+// WriteRetry sets reconnect timing for the session
+func (t *SSETransport) WriteRetry(retry time.Duration) error {
+	return t.write(fmt.Sprintf("retry: %d\n\n", retry.Milliseconds()))
+}
+
+func (t *SSETransport) write(message string) error {
+	if _, err := fmt.Fprint(t.writer, message); err != nil {
+		return err
 	}
+	return t.writerCtl.Flush()
+}
+
+// WSTransport writes events as WebSocket JSON text messages
+type WSTransport struct {
+	conn *websocket.Conn
+}
+
+const wsWriteTimeout = 10 * time.Second
+
+func NewWSTransport(conn *websocket.Conn) *WSTransport {
+	return &WSTransport{
+		conn: conn,
+	}
+}
+
+func (t *WSTransport) WriteEvent(event RoomEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	t.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return t.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (t *WSTransport) WriteHeartbeat() error {
+	t.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return t.conn.WriteMessage(websocket.PingMessage, nil)
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type DisplayCommandName string
+
+const (
+	DisplayCommandReload   DisplayCommandName = "reload"
+	DisplayCommandBanner   DisplayCommandName = "banner"
+	DisplayCommandLanguage DisplayCommandName = "language"
+	DisplayCommandMute     DisplayCommandName = "mute"
+)
+
+// DisplayCommand is control command pushed to displays, so the display fleet can be managed centrally
+type DisplayCommand struct {
+	Command DisplayCommandName `json:"command"`
+
+	// banner. empty message clears the banner
+	Message   string     `json:"message,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// language, e.g. "id", "en"
+	Language string `json:"language,omitempty"`
+
+	// mute
+	IsMuted bool `json:"muted"`
+}
+
+func (dc DisplayCommand) Validate() error {
+	switch dc.Command {
+	case DisplayCommandReload, DisplayCommandMute:
+		return nil
+	case DisplayCommandBanner:
+		if dc.ExpiresAt != nil && dc.ExpiresAt.Before(time.Now()) {
+			return errors.New("banner already expired")
+		}
+		return nil
+	case DisplayCommandLanguage:
+		if dc.Language == "" {
+			return errors.New("language is required")
+		}
+		return nil
+	}
+	return errors.New("invalid display command")
+}
+
+// Event converts command to event named after the command
+func (dc DisplayCommand) Event() (Event, error) {
+	return NewEvent(string(dc.Command), dc)
+}
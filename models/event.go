@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	EventPrinterStatus = "printer_status"
+	EventCall          = "call"
+	EventSnapshot      = "snapshot"
+	EventCommandResult = "command_result"
+	EventAnnouncement  = "announcement"
+	EventWaitEstimate  = "wait_estimate"
+)
+
+// Event is a named room event with JSON data, sent to clients as server-sent event.
+type Event struct {
+	// assigned by event hub, monotonically increasing per room.
+	// zero means event is not part of room history, e.g. snapshot
+	ID   uint64          `json:"id"`
+	Name string          `json:"name"`
+	Data json.RawMessage `json:"data"`
+}
+
+func NewEvent(name string, data interface{}) (Event, error) {
+	datastr, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Name: name,
+		Data: datastr,
+	}, nil
+}
+
+// Format formats event as server-sent event message
+func (e Event) Format() string {
+	if e.ID == 0 {
+		return fmt.Sprintf("event: %s\ndata: %s\n\n", e.Name, e.Data)
+	}
+	return fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Name, e.Data)
+}
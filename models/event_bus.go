@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/redis/go-redis/v9"
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+const (
+	eventChannelPrefix   = "event:"
+	clientCommandChannel = "client_command"
+	// client_registry:{instance id} is clients connected to the instance, by room
+	clientRegistryPrefix = "client_registry:"
+)
+
+type ClientCommandAction string
+
+const (
+	ClientCommandDisconnect ClientCommandAction = "disconnect"
+	ClientCommandSend       ClientCommandAction = "send"
+)
+
+// ClientCommand is an action on all connections of a client. Client may be connected to any instance,
+// so it's relayed to all of them.
+type ClientCommand struct {
+	ClientID string              `json:"client_id"`
+	Action   ClientCommandAction `json:"action"`
+	// only for send
+	Event Event `json:"event"`
+}
+
+// RoomEvent is event relayed between server instances
+type RoomEvent struct {
+	RoomID string `json:"room_id"`
+	Event
+}
+
+// EventBus relays room events between server instances through redis pub/sub,
+// so a call made on one instance reaches displays connected to other instances.
+type EventBus struct {
+	instanceID string
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		instanceID: NewClientID(),
+	}
+}
+
+// Publish assigns room event id shared by all instances, then publishes the event
+func (eb *EventBus) Publish(ctx context.Context, roomID string, event Event) error {
+	id, err := databases.RedisClient.Incr(ctx, getEventSeqKey(roomID)).Result()
+	if err != nil {
+		return err
+	}
+	event.ID = uint64(id)
+
+	payload, err := json.Marshal(RoomEvent{
+		RoomID: roomID,
+		Event:  event,
+	})
+	if err != nil {
+		return err
+	}
+
+	return databases.RedisClient.Publish(ctx, eventChannelPrefix+roomID, payload).Err()
+}
+
+// Subscribe receives events published by all instances, including this one, until ctx is done.
+func (eb *EventBus) Subscribe(ctx context.Context) <-chan RoomEvent {
+	events := make(chan RoomEvent)
+
+	go func() {
+		defer close(events)
+
+		pubsub := databases.RedisClient.PSubscribe(ctx, eventChannelPrefix+"*")
+		defer pubsub.Close()
+
+		// go-redis reconnects and resubscribes automatically
+		for msg := range pubsub.Channel() {
+			var event RoomEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				logs.Error("failed to unmarshal room event: %s", err.Error())
+				continue
+			}
+			if event.RoomID == "" {
+				event.RoomID = strings.TrimPrefix(msg.Channel, eventChannelPrefix)
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// PublishClientCommand relays command to all instances, including this one
+func (eb *EventBus) PublishClientCommand(ctx context.Context, cmd ClientCommand) error {
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return databases.RedisClient.Publish(ctx, clientCommandChannel, payload).Err()
+}
+
+// SubscribeClientCommands receives commands published by all instances, including this one, until ctx is done.
+func (eb *EventBus) SubscribeClientCommands(ctx context.Context) <-chan ClientCommand {
+	cmds := make(chan ClientCommand)
+
+	go func() {
+		defer close(cmds)
+
+		pubsub := databases.RedisClient.Subscribe(ctx, clientCommandChannel)
+		defer pubsub.Close()
+
+		for msg := range pubsub.Channel() {
+			var cmd ClientCommand
+			if err := json.Unmarshal([]byte(msg.Payload), &cmd); err != nil {
+				logs.Error("failed to unmarshal client command: %s", err.Error())
+				continue
+			}
+
+			select {
+			case cmds <- cmd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cmds
+}
+
+// SaveClients records clients connected to this instance, by room. Registry of an instance which
+// stops saving expires after ttl.
+func (eb *EventBus) SaveClients(ctx context.Context, clients map[string][]ClientInfo, ttl time.Duration) error {
+	clientsstr, err := json.Marshal(clients)
+	if err != nil {
+		return err
+	}
+
+	return databases.RedisClient.Set(ctx, clientRegistryPrefix+eb.instanceID, clientsstr, ttl).Err()
+}
+
+// ListRemoteClients returns clients connected to other instances, by room
+func (eb *EventBus) ListRemoteClients(ctx context.Context) (map[string][]ClientInfo, error) {
+	keys, err := scanKeys(ctx, clientRegistryPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make(map[string][]ClientInfo)
+	for _, key := range keys {
+		if key == clientRegistryPrefix+eb.instanceID {
+			continue
+		}
+
+		clientsstr, err := databases.RedisClient.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			// expired since scanned
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var instanceClients map[string][]ClientInfo
+		if err := json.Unmarshal(clientsstr, &instanceClients); err != nil {
+			logs.Error("failed to unmarshal client registry %s: %s", key, err.Error())
+			continue
+		}
+		for roomID, infos := range instanceClients {
+			clients[roomID] = append(clients[roomID], infos...)
+		}
+	}
+	return clients, nil
+}
+
+func getEventSeqKey(roomID string) string {
+	return fmt.Sprintf("event:%s:seq", roomID)
+}
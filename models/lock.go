@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+// releaseLockScript deletes the lock only if it's still held by the token, so an instance whose lock
+// has expired doesn't release a lock taken over by another instance
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock is a redis lock shared by all instances in multi node mode
+type Lock struct {
+	key   string
+	token string
+}
+
+// AcquireLock takes the lock for ttl. It returns nil lock if another instance holds it.
+func AcquireLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	lock := &Lock{
+		key:   key,
+		token: hex.EncodeToString(b),
+	}
+
+	isLocked, err := databases.RedisClient.SetNX(ctx, key, lock.token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !isLocked {
+		return nil, nil
+	}
+	return lock, nil
+}
+
+// Release releases the lock if it's still held
+func (l *Lock) Release(ctx context.Context) error {
+	return releaseLockScript.Run(ctx, databases.RedisClient, []string{l.key}, l.token).Err()
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type NumberingOverflow string
+
+const (
+	// reject new ticket once the number doesn't fit in length
+	NumberingOverflowError NumberingOverflow = "error"
+	// restart from start number, so numbers may repeat within a day
+	NumberingOverflowWrap NumberingOverflow = "wrap"
+)
+
+var (
+	ErrQueueNumberExceeded = errors.New("max daily generated number exceeded")
+	ErrUnknownPriority     = errors.New("unknown priority class")
+)
+
+// QueueNumbering decides how queue numbers of a room look, e.g. prefix "REG-", start 101 prints as REG-101, REG-102, ...
+type QueueNumbering struct {
+	// default to room id
+	Prefix *string `json:"prefix"`
+	// number of digits, default to 3
+	Length int `json:"length"`
+	// whether to pad number with leading zeroes up to length, default to true
+	IsPadZeroes *bool `json:"pad_zeroes"`
+	// first number of the day, default to 1
+	Start int `json:"start"`
+	// increment between numbers, default to 1
+	Step     int               `json:"step"`
+	Overflow NumberingOverflow `json:"on_overflow"`
+	// priority class -> prefix used instead of Prefix, e.g. "elderly": "P-"
+	PriorityPrefixes map[string]string `json:"priority_prefixes"`
+}
+
+var DefaultQueueNumbering = QueueNumbering{
+	Length:   3,
+	Start:    1,
+	Step:     1,
+	Overflow: NumberingOverflowError,
+}
+
+// withDefaults fills unset fields of room numbering
+func (n QueueNumbering) withDefaults(roomID string) QueueNumbering {
+	if n.Prefix == nil {
+		n.Prefix = &roomID
+	}
+	if n.Length <= 0 {
+		n.Length = DefaultQueueNumbering.Length
+	}
+	if n.IsPadZeroes == nil {
+		isPadZeroes := true
+		n.IsPadZeroes = &isPadZeroes
+	}
+	if n.Start <= 0 {
+		n.Start = DefaultQueueNumbering.Start
+	}
+	if n.Step <= 0 {
+		n.Step = DefaultQueueNumbering.Step
+	}
+	if n.Overflow == "" {
+		n.Overflow = DefaultQueueNumbering.Overflow
+	}
+	return n
+}
+
+func (n QueueNumbering) Validate() error {
+	if n.Length > 18 {
+		return errors.New("numbering length must not exceed 18 digits")
+	}
+	if n.Overflow != NumberingOverflowError && n.Overflow != NumberingOverflowWrap {
+		return fmt.Errorf("invalid numbering overflow %q", n.Overflow)
+	}
+	if n.Start > n.max() {
+		return fmt.Errorf("numbering start %d doesn't fit in %d digits", n.Start, n.Length)
+	}
+	return nil
+}
+
+// Prefixes returns all prefixes numbers may start with
+func (n QueueNumbering) Prefixes() []string {
+	prefixes := []string{*n.Prefix}
+	for _, prefix := range n.PriorityPrefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// Format returns queue number of nth (1-based) ticket of the day
+func (n QueueNumbering) Format(sequence int64, priority string) (string, error) {
+	prefix := *n.Prefix
+	if priority != "" {
+		priorityPrefix, ok := n.PriorityPrefixes[priority]
+		if !ok {
+			return "", ErrUnknownPriority
+		}
+		prefix = priorityPrefix
+	}
+
+	number := int64(n.Start) + (sequence-1)*int64(n.Step)
+	if max := int64(n.max()); number > max {
+		if n.Overflow != NumberingOverflowWrap {
+			return "", ErrQueueNumberExceeded
+		}
+		number = int64(n.Start) + ((sequence-1)%int64(n.count()))*int64(n.Step)
+	}
+
+	numberstr := strconv.FormatInt(number, 10)
+	if *n.IsPadZeroes {
+		numberstr = fmt.Sprintf("%0*d", n.Length, number)
+	}
+
+	return prefix + numberstr, nil
+}
+
+// Capacity returns how many numbers can be created in a day, 0 if numbers wrap around
+func (n QueueNumbering) Capacity() int {
+	if n.Overflow == NumberingOverflowWrap {
+		return 0
+	}
+	return n.count()
+}
+
+// isWrapped returns whether number of nth ticket of the day has been given out earlier in the day
+func (n QueueNumbering) isWrapped(sequence int64) bool {
+	return n.Overflow == NumberingOverflowWrap && sequence > int64(n.count())
+}
+
+// count returns how many distinct numbers fit in length
+func (n QueueNumbering) count() int {
+	return (n.max()-n.Start)/n.Step + 1
+}
+
+// max returns the largest number fitting in length
+func (n QueueNumbering) max() int {
+	max := 1
+	for i := 0; i < n.Length; i++ {
+		max *= 10
+	}
+	return max - 1
+}
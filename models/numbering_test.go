@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQueueNumberingFormat(t *testing.T) {
+	prefix := "REG-"
+	empty := ""
+	noPad := false
+
+	tests := []struct {
+		name      string
+		numbering QueueNumbering
+		sequence  int64
+		priority  string
+		want      string
+		wantErr   error
+	}{
+		{name: "defaults", numbering: QueueNumbering{}, sequence: 1, want: "A001"},
+		{name: "prefix", numbering: QueueNumbering{Prefix: &prefix}, sequence: 12, want: "REG-012"},
+		{name: "empty prefix", numbering: QueueNumbering{Prefix: &empty}, sequence: 12, want: "012"},
+		{name: "no padding", numbering: QueueNumbering{IsPadZeroes: &noPad}, sequence: 12, want: "A12"},
+		{name: "start and step", numbering: QueueNumbering{Start: 101, Step: 2}, sequence: 3, want: "A105"},
+		{name: "last number", numbering: QueueNumbering{Length: 2}, sequence: 99, want: "A99"},
+		{
+			name:      "priority prefix",
+			numbering: QueueNumbering{PriorityPrefixes: map[string]string{"elderly": "P-"}},
+			sequence:  7,
+			priority:  "elderly",
+			want:      "P-007",
+		},
+		{
+			name:      "unknown priority",
+			numbering: QueueNumbering{PriorityPrefixes: map[string]string{"elderly": "P-"}},
+			sequence:  7,
+			priority:  "vip",
+			wantErr:   ErrUnknownPriority,
+		},
+		{name: "overflow error", numbering: QueueNumbering{Length: 2}, sequence: 100, wantErr: ErrQueueNumberExceeded},
+		{
+			name:      "overflow error with start and step",
+			numbering: QueueNumbering{Length: 2, Start: 10, Step: 10},
+			sequence:  10,
+			wantErr:   ErrQueueNumberExceeded,
+		},
+		{
+			name:      "wrap to start",
+			numbering: QueueNumbering{Length: 1, Overflow: NumberingOverflowWrap},
+			sequence:  10,
+			want:      "A1",
+		},
+		{
+			name:      "wrap twice",
+			numbering: QueueNumbering{Length: 1, Overflow: NumberingOverflowWrap},
+			sequence:  21,
+			want:      "A3",
+		},
+		{
+			// 10, 30, 50, 70, 90, then 10 again
+			name:      "wrap with start and step",
+			numbering: QueueNumbering{Length: 2, Start: 10, Step: 20, Overflow: NumberingOverflowWrap},
+			sequence:  6,
+			want:      "A10",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.numbering.withDefaults("A").Format(tt.sequence, tt.priority)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestQueueNumberingCapacity(t *testing.T) {
+	tests := []struct {
+		name      string
+		numbering QueueNumbering
+		want      int
+	}{
+		{name: "defaults", numbering: QueueNumbering{}, want: 999},
+		{name: "start", numbering: QueueNumbering{Start: 101}, want: 899},
+		{name: "step", numbering: QueueNumbering{Length: 2, Start: 10, Step: 20}, want: 5},
+		{name: "step not reaching max", numbering: QueueNumbering{Length: 2, Step: 7}, want: 15},
+		{name: "wrap", numbering: QueueNumbering{Overflow: NumberingOverflowWrap}, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.numbering.withDefaults("A").Capacity(); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestQueueNumberingIsWrapped(t *testing.T) {
+	wrap := QueueNumbering{Length: 1, Overflow: NumberingOverflowWrap}.withDefaults("A")
+	noWrap := QueueNumbering{Length: 1}.withDefaults("A")
+
+	tests := []struct {
+		name      string
+		numbering QueueNumbering
+		sequence  int64
+		want      bool
+	}{
+		{name: "first round", numbering: wrap, sequence: 9, want: false},
+		{name: "second round", numbering: wrap, sequence: 10, want: true},
+		{name: "no wrap", numbering: noWrap, sequence: 10, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.numbering.isWrapped(tt.sequence); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// how far ahead next opening time is searched, e.g. to skip long holidays
+const openingLookahead = 31
+
+var weekdayKeys = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// OpeningHours is when a room accepts tickets, in business timezone. Room without schedule is always open.
+type OpeningHours struct {
+	// weekday (sun, mon, ..., sat) -> open ranges. weekday not listed is closed
+	Schedule map[string][]TimeRange `json:"schedule"`
+	// closed ranges applied to every day, e.g. lunch break
+	Breaks []TimeRange `json:"breaks"`
+	// closed calendar dates, YYYY-MM-DD. like schedule, it follows calendar date rather than business day,
+	// so a range after midnight of an overnight shift is closed on the holiday after it
+	Holidays []string `json:"holidays"`
+	// stop issuing tickets this many minutes before closing, so the last patient can still be served
+	LastTicketMinutes int `json:"last_ticket_minutes"`
+
+	// parsed from above by compile
+	ranges   map[time.Weekday][]minuteRange
+	holidays map[string]bool
+}
+
+// TimeRange is a range within a day, HH:MM. End may be 24:00.
+// Overnight range is split at midnight, e.g. mon 22:00-24:00 and tue 00:00-06:00.
+type TimeRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// minuteRange is [start, end) in minutes since midnight
+type minuteRange struct {
+	start int
+	end   int
+}
+
+// RoomOpenStatus is whether room is open now, and when it changes
+type RoomOpenStatus struct {
+	IsOpen bool `json:"is_open"`
+	// false after last ticket cutoff, even though room is still open
+	IsAcceptingTickets bool       `json:"is_accepting_tickets"`
+	ClosesAt           *time.Time `json:"closes_at,omitempty"`
+	// next time room accepts tickets, only when it's not accepting tickets now
+	NextOpenAt *time.Time `json:"next_open_at,omitempty"`
+}
+
+// RoomClosedError is returned when ticket is created while room doesn't accept tickets
+type RoomClosedError struct {
+	// nil if room has no opening in the near future
+	NextOpenAt *time.Time
+}
+
+func (e *RoomClosedError) Error() string {
+	if e.NextOpenAt == nil {
+		return "room is closed"
+	}
+	return fmt.Sprintf("room is closed, opens at %s", e.NextOpenAt.Format(time.RFC3339))
+}
+
+func (h OpeningHours) IsEnabled() bool {
+	return len(h.Schedule) > 0
+}
+
+// compile validates and parses opening hours
+func (h OpeningHours) compile() (OpeningHours, error) {
+	if h.LastTicketMinutes < 0 {
+		return OpeningHours{}, errors.New("last ticket minutes must not be negative")
+	}
+
+	breaks, err := parseTimeRanges(h.Breaks)
+	if err != nil {
+		return OpeningHours{}, fmt.Errorf("breaks: %w", err)
+	}
+
+	h.ranges = make(map[time.Weekday][]minuteRange)
+	for key, ranges := range h.Schedule {
+		weekday, ok := weekdayKeys[key]
+		if !ok {
+			return OpeningHours{}, fmt.Errorf("invalid weekday %q, expected sun, mon, ..., sat", key)
+		}
+
+		open, err := parseTimeRanges(ranges)
+		if err != nil {
+			return OpeningHours{}, fmt.Errorf("%s: %w", key, err)
+		}
+		for _, b := range breaks {
+			open = subtractRange(open, b)
+		}
+		slices.SortFunc(open, func(a, b minuteRange) int {
+			return a.start - b.start
+		})
+		h.ranges[weekday] = open
+	}
+
+	h.holidays = make(map[string]bool)
+	for _, holiday := range h.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			return OpeningHours{}, fmt.Errorf("invalid holiday %q, expected YYYY-MM-DD", holiday)
+		}
+		h.holidays[holiday] = true
+	}
+
+	return h, nil
+}
+
+// Status returns open status of the room at the time
+func (h OpeningHours) Status(now time.Time) RoomOpenStatus {
+	if !h.IsEnabled() {
+		return RoomOpenStatus{
+			IsOpen:             true,
+			IsAcceptingTickets: true,
+		}
+	}
+
+	local := now.In(businessLoc)
+	minute := local.Hour()*60 + local.Minute()
+
+	var status RoomOpenStatus
+	for _, r := range h.rangesOn(local) {
+		if minute < r.start || minute >= r.end {
+			continue
+		}
+
+		closesAt := h.closingAt(local, r.end)
+		status.IsOpen = true
+		status.ClosesAt = &closesAt
+		status.IsAcceptingTickets = local.Before(closesAt.Add(-time.Duration(h.LastTicketMinutes) * time.Minute))
+		break
+	}
+
+	if !status.IsAcceptingTickets {
+		status.NextOpenAt = h.nextOpen(local)
+	}
+	return status
+}
+
+// closingAt returns when range ending at minute end of local's date closes. Range ending at midnight continues
+// into range of the next date starting at 00:00, i.e. overnight range.
+func (h OpeningHours) closingAt(local time.Time, end int) time.Time {
+	day := local
+	for d := 0; end == 24*60 && d < openingLookahead; d++ {
+		next := day.AddDate(0, 0, 1)
+		ranges := h.rangesOn(next)
+		if len(ranges) == 0 || ranges[0].start != 0 {
+			break
+		}
+		day, end = next, ranges[0].end
+	}
+	return atMinute(day, end)
+}
+
+// nextOpen returns start of the first open range after local, nil if there's none soon
+func (h OpeningHours) nextOpen(local time.Time) *time.Time {
+	for d := 0; d <= openingLookahead; d++ {
+		day := local.AddDate(0, 0, d)
+		for _, r := range h.rangesOn(day) {
+			start := atMinute(day, r.start)
+			if start.After(local) {
+				return &start
+			}
+		}
+	}
+	return nil
+}
+
+// rangesOn returns open ranges on the calendar date of local
+func (h OpeningHours) rangesOn(local time.Time) []minuteRange {
+	if h.holidays[local.Format("2006-01-02")] {
+		return nil
+	}
+	return h.ranges[local.Weekday()]
+}
+
+// atMinute returns the time at minute since midnight of local's date
+func atMinute(local time.Time, minute int) time.Time {
+	year, month, day := local.Date()
+	return time.Date(year, month, day, 0, minute, 0, 0, local.Location())
+}
+
+func parseTimeRanges(ranges []TimeRange) ([]minuteRange, error) {
+	parsed := make([]minuteRange, 0, len(ranges))
+	for _, r := range ranges {
+		start, err := parseMinute(r.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseMinute(r.End)
+		if err != nil {
+			return nil, err
+		}
+		if start >= end {
+			return nil, fmt.Errorf("range %s-%s must start before it ends", r.Start, r.End)
+		}
+		parsed = append(parsed, minuteRange{start: start, end: end})
+	}
+	return parsed, nil
+}
+
+// parseMinute parses HH:MM into minutes since midnight
+func parseMinute(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// subtractRange removes b from each range, splitting a range b falls in the middle of
+func subtractRange(ranges []minuteRange, b minuteRange) []minuteRange {
+	var result []minuteRange
+	for _, r := range ranges {
+		if b.end <= r.start || b.start >= r.end {
+			result = append(result, r)
+			continue
+		}
+		if r.start < b.start {
+			result = append(result, minuteRange{start: r.start, end: b.start})
+		}
+		if b.end < r.end {
+			result = append(result, minuteRange{start: b.end, end: r.end})
+		}
+	}
+	return result
+}
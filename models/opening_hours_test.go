@@ -0,0 +1,274 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// setBusinessDay overrides business timezone and cutover hour for the test
+func setBusinessDay(t *testing.T, loc *time.Location, cutoverHour int) {
+	t.Helper()
+
+	prevLoc, prevCutoverHour := businessLoc, businessCutoverHour
+	businessLoc, businessCutoverHour = loc, cutoverHour
+	t.Cleanup(func() {
+		businessLoc, businessCutoverHour = prevLoc, prevCutoverHour
+	})
+}
+
+func mustCompile(t *testing.T, h OpeningHours) OpeningHours {
+	t.Helper()
+
+	compiled, err := h.compile()
+	if err != nil {
+		t.Fatalf("failed to compile opening hours: %s", err.Error())
+	}
+	return compiled
+}
+
+// oct returns time on the day of October 2026, 19th is Monday
+func oct(day, hour, minute int) time.Time {
+	return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "nil"
+	}
+	return t.Format("Mon 02 15:04")
+}
+
+func formatStatus(s RoomOpenStatus) string {
+	return fmt.Sprintf("open=%v accepting=%v closes=%s next=%s",
+		s.IsOpen, s.IsAcceptingTickets, formatTime(s.ClosesAt), formatTime(s.NextOpenAt))
+}
+
+func TestOpeningHoursStatus(t *testing.T) {
+	weekday := OpeningHours{
+		Schedule: map[string][]TimeRange{
+			"mon": {{Start: "08:00", End: "12:00"}, {Start: "13:00", End: "17:00"}},
+			"tue": {{Start: "08:00", End: "12:00"}},
+			"sat": {{Start: "08:00", End: "12:00"}},
+		},
+		Breaks:            []TimeRange{{Start: "10:00", End: "10:30"}},
+		Holidays:          []string{"2026-10-20"},
+		LastTicketMinutes: 30,
+	}
+	overnight := OpeningHours{
+		Schedule: map[string][]TimeRange{
+			"fri": {{Start: "22:00", End: "24:00"}},
+			"sat": {{Start: "00:00", End: "06:00"}},
+		},
+		LastTicketMinutes: 30,
+	}
+	overnightHoliday := overnight
+	overnightHoliday.Holidays = []string{"2026-10-24"}
+
+	tests := []struct {
+		name        string
+		hours       OpeningHours
+		cutoverHour int
+		now         time.Time
+		want        string
+	}{
+		{
+			name:  "no schedule",
+			hours: OpeningHours{},
+			now:   oct(19, 3, 0),
+			want:  "open=true accepting=true closes=nil next=nil",
+		},
+		{
+			name:  "before open",
+			hours: weekday,
+			now:   oct(19, 7, 0),
+			want:  "open=false accepting=false closes=nil next=Mon 19 08:00",
+		},
+		{
+			name:  "open until break",
+			hours: weekday,
+			now:   oct(19, 9, 0),
+			want:  "open=true accepting=true closes=Mon 19 10:00 next=nil",
+		},
+		{
+			name:  "on break",
+			hours: weekday,
+			now:   oct(19, 10, 15),
+			want:  "open=false accepting=false closes=nil next=Mon 19 10:30",
+		},
+		{
+			name:  "just before last ticket",
+			hours: weekday,
+			now:   oct(19, 11, 29),
+			want:  "open=true accepting=true closes=Mon 19 12:00 next=nil",
+		},
+		{
+			name:  "after last ticket",
+			hours: weekday,
+			now:   oct(19, 11, 30),
+			want:  "open=true accepting=false closes=Mon 19 12:00 next=Mon 19 13:00",
+		},
+		{
+			// tuesday is holiday, nothing scheduled until saturday
+			name:  "after close skips holiday",
+			hours: weekday,
+			now:   oct(19, 17, 0),
+			want:  "open=false accepting=false closes=nil next=Sat 24 08:00",
+		},
+		{
+			name:  "holiday",
+			hours: weekday,
+			now:   oct(20, 9, 0),
+			want:  "open=false accepting=false closes=nil next=Sat 24 08:00",
+		},
+		{
+			name:  "overnight before midnight",
+			hours: overnight,
+			now:   oct(23, 23, 50),
+			want:  "open=true accepting=true closes=Sat 24 06:00 next=nil",
+		},
+		{
+			name:  "overnight after midnight",
+			hours: overnight,
+			now:   oct(24, 5, 45),
+			want:  "open=true accepting=false closes=Sat 24 06:00 next=Fri 30 22:00",
+		},
+		{
+			name:  "overnight before open",
+			hours: overnight,
+			now:   oct(23, 21, 0),
+			want:  "open=false accepting=false closes=nil next=Fri 23 22:00",
+		},
+		{
+			name:  "overnight last ticket before midnight",
+			hours: overnightHoliday,
+			now:   oct(23, 23, 30),
+			want:  "open=true accepting=false closes=Sat 24 00:00 next=Fri 30 22:00",
+		},
+		{
+			// 02:00 is still friday business day, but schedule follows calendar date
+			name:        "after midnight before cutover",
+			hours:       overnight,
+			cutoverHour: 4,
+			now:         oct(24, 2, 0),
+			want:        "open=true accepting=true closes=Sat 24 06:00 next=nil",
+		},
+		{
+			name:        "holiday after midnight before cutover",
+			hours:       overnightHoliday,
+			cutoverHour: 4,
+			now:         oct(24, 2, 0),
+			want:        "open=false accepting=false closes=nil next=Fri 30 22:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setBusinessDay(t, time.UTC, tt.cutoverHour)
+
+			got := formatStatus(mustCompile(t, tt.hours).Status(tt.now))
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOpeningHoursNextOpen(t *testing.T) {
+	setBusinessDay(t, time.UTC, 0)
+
+	hours := OpeningHours{
+		Schedule: map[string][]TimeRange{
+			"mon": {{Start: "08:00", End: "12:00"}},
+		},
+		Breaks: []TimeRange{{Start: "10:00", End: "10:30"}},
+	}
+	allBreak := hours
+	allBreak.Breaks = []TimeRange{{Start: "00:00", End: "24:00"}}
+	holidays := hours
+	holidays.Holidays = []string{"2026-10-26", "2026-11-02"}
+	longHolidays := hours
+	longHolidays.Holidays = []string{"2026-10-26", "2026-11-02", "2026-11-09", "2026-11-16"}
+
+	tests := []struct {
+		name  string
+		hours OpeningHours
+		local time.Time
+		want  string
+	}{
+		{name: "later today", hours: hours, local: oct(19, 7, 0), want: "Mon 19 08:00"},
+		// start is strictly after local
+		{name: "at start", hours: hours, local: oct(19, 8, 0), want: "Mon 19 10:30"},
+		{name: "next week", hours: hours, local: oct(19, 11, 0), want: "Mon 26 08:00"},
+		{name: "after holidays", hours: holidays, local: oct(19, 11, 0), want: "Mon 09 08:00"},
+		// next opening is beyond lookahead
+		{name: "after long holidays", hours: longHolidays, local: oct(19, 11, 0), want: "nil"},
+		{name: "all day break", hours: allBreak, local: oct(19, 7, 0), want: "nil"},
+	}
+
+	for _, tt := range tests {
+		got := formatTime(mustCompile(t, tt.hours).nextOpen(tt.local))
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSubtractRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []minuteRange
+		b      minuteRange
+		want   []minuteRange
+	}{
+		{
+			name:   "before",
+			ranges: []minuteRange{{start: 60, end: 120}},
+			b:      minuteRange{start: 0, end: 30},
+			want:   []minuteRange{{start: 60, end: 120}},
+		},
+		{
+			name:   "touching end",
+			ranges: []minuteRange{{start: 60, end: 120}},
+			b:      minuteRange{start: 120, end: 180},
+			want:   []minuteRange{{start: 60, end: 120}},
+		},
+		{
+			name:   "middle",
+			ranges: []minuteRange{{start: 60, end: 120}},
+			b:      minuteRange{start: 80, end: 90},
+			want:   []minuteRange{{start: 60, end: 80}, {start: 90, end: 120}},
+		},
+		{
+			name:   "overlap start",
+			ranges: []minuteRange{{start: 60, end: 120}},
+			b:      minuteRange{start: 30, end: 90},
+			want:   []minuteRange{{start: 90, end: 120}},
+		},
+		{
+			name:   "overlap end",
+			ranges: []minuteRange{{start: 60, end: 120}},
+			b:      minuteRange{start: 90, end: 150},
+			want:   []minuteRange{{start: 60, end: 90}},
+		},
+		{
+			name:   "whole",
+			ranges: []minuteRange{{start: 60, end: 120}},
+			b:      minuteRange{start: 60, end: 120},
+			want:   nil,
+		},
+		{
+			name:   "across ranges",
+			ranges: []minuteRange{{start: 60, end: 120}, {start: 180, end: 240}},
+			b:      minuteRange{start: 100, end: 200},
+			want:   []minuteRange{{start: 60, end: 100}, {start: 200, end: 240}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := subtractRange(tt.ranges, tt.b)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -1,13 +1,25 @@
 package models
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
 	"math"
+	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
 	"github.com/jung-kurt/gofpdf"
 )
 
@@ -15,32 +27,164 @@ const (
 	// printMethodLP prints by creating temp .pdf file and print using lp command.
 	// However, this method only works if the printer is located at server.
 	printMethodLP = "lp"
+	// printMethodFile writes .pdf file to a directory instead of printing.
+	// Useful to design templates and test dispenser without physical printer.
+	printMethodFile = "file"
 	// PrintMethodPOS  = "pos"
 	// PrintMethodIPP  = "ipp"
 
-	contentText  = "text"
-	contentImage = "image"
+	contentText    = "text"
+	contentImage   = "image"
+	contentQRCode  = "qrcode"
+	contentBarcode = "barcode"
 )
 
+type PrinterState string
+
+const (
+	PrinterStateUnknown  PrinterState = "unknown"
+	PrinterStateDisabled PrinterState = "disabled"
+	PrinterStateOnline   PrinterState = "online"
+	PrinterStateOffline  PrinterState = "offline"
+	PrinterStatePaperLow PrinterState = "paper_low"
+	PrinterStatePaperOut PrinterState = "paper_out"
+)
+
+type PrinterStatus struct {
+	State     PrinterState `json:"state"`
+	Message   string       `json:"message,omitempty"`
+	CheckedAt time.Time    `json:"checked_at"`
+}
+
+// IsDown reports whether printer is known to be unable to print
+func (ps PrinterStatus) IsDown() bool {
+	return ps.State == PrinterStateOffline || ps.State == PrinterStatePaperOut
+}
+
 type PrinterBuilder struct {
 	lines []printerLine
 }
 
 type Printer struct {
-	isEnabled bool
-	method    string
-	lines     []printerLine
+	PrinterConfig
+	fonts PrinterFonts
+	lines []printerLine
+}
+
+// PrinterConfig is physical printer configuration.
+// Routing fields decide which printer a ticket comes out of.
+type PrinterConfig struct {
+	IsEnabled bool   `json:"enable"`
+	Method    string `json:"method"`
+	Name      string `json:"name"` // printer destination, empty means system default
+	Dir       string `json:"dir"`
+
+	// routing: dispenser client ids take precedence over source room ids
+	RoomIDs   []string `json:"room_ids"`
+	ClientIDs []string `json:"client_ids"`
+}
+
+// DefaultPrinterConfig reads printer configuration from [printer] section
+func DefaultPrinterConfig() PrinterConfig {
+	isEnabled, err := web.AppConfig.Bool("printer::enable")
+	if err != nil {
+		isEnabled = false
+	}
+
+	method, err := web.AppConfig.String("printer::method")
+	if err != nil {
+		isEnabled = false
+	}
+
+	name, err := web.AppConfig.String("printer::name")
+	if err != nil {
+		name = ""
+	}
+
+	dir, err := web.AppConfig.String("printer::dir")
+	if err != nil {
+		dir = ""
+	}
+
+	return PrinterConfig{
+		IsEnabled: isEnabled,
+		Method:    method,
+		Name:      name,
+		Dir:       dir,
+	}
+}
+
+// PrinterFonts is custom TTF font family, loaded with UTF-8 support
+// so non Latin-1 text (e.g. names, Chinese subtitle) can be rendered.
+// Zero value uses core font.
+type PrinterFonts struct {
+	Family  string
+	regular []byte
+	bold    []byte
+}
+
+// LoadPrinterFonts reads custom font files from [printer] section once, so a missing or invalid font
+// is reported at startup instead of failing every ticket. Custom font is optional, fallback to core font.
+func LoadPrinterFonts() (PrinterFonts, error) {
+	regularPath, _ := web.AppConfig.String("printer::font_regular")
+	if regularPath == "" {
+		return PrinterFonts{Family: defaultFont}, nil
+	}
+
+	fonts := PrinterFonts{
+		Family: web.AppConfig.DefaultString("printer::font_family", "custom"),
+	}
+
+	var err error
+	fonts.regular, err = os.ReadFile(regularPath)
+	if err != nil {
+		return PrinterFonts{}, fmt.Errorf("fail to read font file: %w", err)
+	}
+
+	fonts.bold = fonts.regular
+	if boldPath, _ := web.AppConfig.String("printer::font_bold"); boldPath != "" {
+		fonts.bold, err = os.ReadFile(boldPath)
+		if err != nil {
+			return PrinterFonts{}, fmt.Errorf("fail to read font file: %w", err)
+		}
+	}
+
+	// parse once, so invalid font file fails here instead of every ticket
+	pdf := gofpdf.New(gofpdf.OrientationPortrait, gofpdf.UnitMillimeter, "A4", "")
+	fonts.add(pdf)
+	pdf.SetFont(fonts.Family, "B", defaultFontSize)
+	if err := pdf.Error(); err != nil {
+		return PrinterFonts{}, fmt.Errorf("invalid font file: %w", err)
+	}
+
+	return fonts, nil
+}
+
+// add registers custom font to pdf, if any
+func (f PrinterFonts) add(pdf *gofpdf.Fpdf) {
+	if f.regular == nil {
+		return
+	}
+	pdf.AddUTF8FontFromBytes(f.Family, "", f.regular)
+	pdf.AddUTF8FontFromBytes(f.Family, "B", f.bold)
 }
 
 type printerLine struct {
 	Content string
 
 	Text  string
+	Font  string // font family, empty means printer default
 	Size  FontSize
 	Style FontStyle
 
 	ImagePath string
 
+	// Code is the data encoded in QR code or barcode line.
+	// CodeWidth and CodeHeight are in mm.
+	Code       string
+	CodeWidth  float64
+	CodeHeight float64
+
 	// Spacing in N multiplier. 1N = 8 Points = 8 * 0.35278 mm
 	SpacingN float64
 }
@@ -53,12 +197,28 @@ func WithPrinterLineSize(size FontSize) LineOptions {
 	}
 }
 
+// WithPrinterLineFont sets font family of the line.
+// Family must be either core font (e.g. helvetica, courier) or the configured custom font.
+func WithPrinterLineFont(family string) LineOptions {
+	return func(pl *printerLine) {
+		pl.Font = family
+	}
+}
+
 func WithPrinterLineStyle(style FontStyle) LineOptions {
 	return func(pl *printerLine) {
 		pl.Style = style
 	}
 }
 
+// WithPrinterCodeSize sets QR code or barcode size in mm.
+func WithPrinterCodeSize(width, height float64) LineOptions {
+	return func(pl *printerLine) {
+		pl.CodeWidth = width
+		pl.CodeHeight = height
+	}
+}
+
 type FontSize struct {
 	// 1 Point = 0.35278 mm
 	Point int
@@ -103,6 +263,36 @@ func (pb *PrinterBuilder) AddImage(imagePath string) *PrinterBuilder {
 	})
 }
 
+// AddQRCode adds QR code line. Default size is 30x30 mm.
+func (pb *PrinterBuilder) AddQRCode(data string, opts ...LineOptions) *PrinterBuilder {
+	pl := printerLine{
+		Content:    contentQRCode,
+		Code:       data,
+		CodeWidth:  30,
+		CodeHeight: 30,
+		SpacingN:   1,
+	}
+	for _, opt := range opts {
+		opt(&pl)
+	}
+	return pb.addLine(pl)
+}
+
+// AddBarcode adds Code 128 barcode line. Default size is 50x10 mm.
+func (pb *PrinterBuilder) AddBarcode(data string, opts ...LineOptions) *PrinterBuilder {
+	pl := printerLine{
+		Content:    contentBarcode,
+		Code:       data,
+		CodeWidth:  50,
+		CodeHeight: 10,
+		SpacingN:   1,
+	}
+	for _, opt := range opts {
+		opt(&pl)
+	}
+	return pb.addLine(pl)
+}
+
 func (pb *PrinterBuilder) AddSpace(spacingN float64) *PrinterBuilder {
 	return pb.addLine(printerLine{
 		Content:  contentText,
@@ -111,33 +301,33 @@ func (pb *PrinterBuilder) AddSpace(spacingN float64) *PrinterBuilder {
 	})
 }
 
-func (pb *PrinterBuilder) Build() *Printer {
-	isEnabled, err := web.AppConfig.Bool("printer::enable")
-	if err != nil {
-		isEnabled = false
+// Build creates printer with the lines. Fonts are loaded by LoadPrinterFonts.
+func (pb *PrinterBuilder) Build(cfg PrinterConfig, fonts PrinterFonts) *Printer {
+	if cfg.Dir == "" {
+		cfg.Dir = "tickets"
 	}
-
-	method, err := web.AppConfig.String("printer::method")
-	if err != nil {
-		isEnabled = false
+	if fonts.Family == "" {
+		fonts.Family = defaultFont
 	}
 
 	return &Printer{
-		isEnabled: isEnabled,
-		method:    method,
-		lines:     pb.lines,
+		PrinterConfig: cfg,
+		fonts:         fonts,
+		lines:         pb.lines,
 	}
 }
 
 func (p *Printer) Print() error {
-	if !p.isEnabled {
+	if !p.IsEnabled {
 		logs.Info("Printer disabled, skipping print")
 		return nil
 	}
 
-	switch p.method {
+	switch p.Method {
 	case printMethodLP:
 		return p.printLP()
+	case printMethodFile:
+		return p.printFile()
 	default:
 		return errors.New("printer: unsupported print method")
 	}
@@ -145,21 +335,208 @@ func (p *Printer) Print() error {
 
 // printLP prints lines to pdf file and send to printer using lp command
 func (p *Printer) printLP() error {
-	// subsequent file will overwrite previous file
-	outPath := "tmp_queue.pdf"
+	// file per job, so printers printing at the same time don't overwrite each other's ticket
+	tmp, err := os.CreateTemp("", "queue-*.pdf")
+	if err != nil {
+		return fmt.Errorf("fail to create temp file: %w", err)
+	}
+	outPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(outPath)
+
 	if err := p.printPDF(outPath); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("lp", outPath)
-	_, err := cmd.CombinedOutput()
-	if err != nil {
+	args := []string{outPath}
+	if p.Name != "" {
+		args = []string{"-d", p.Name, outPath}
+	}
+
+	cmd := exec.Command("lp", args...)
+	if _, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("fail to send lp command: %w", err)
 	}
 
 	return nil
 }
 
+// Status checks whether printer is ready to print
+func (p *Printer) Status() PrinterStatus {
+	status := PrinterStatus{
+		State:     PrinterStateUnknown,
+		CheckedAt: time.Now(),
+	}
+
+	if !p.IsEnabled {
+		status.State = PrinterStateDisabled
+		return status
+	}
+
+	switch p.Method {
+	case printMethodLP:
+		status.State, status.Message = p.statusLP()
+	case printMethodFile:
+		status.State = PrinterStateOnline
+		if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+			status.State, status.Message = PrinterStateOffline, err.Error()
+		}
+	}
+
+	return status
+}
+
+// lpstat may hang when CUPS is unresponsive, which would stall status check of all printers
+const lpstatTimeout = 5 * time.Second
+
+// statusLP checks printer destination with lpstat. Empty printer name checks system default destination,
+// so other printers on the server don't affect the status.
+func (p *Printer) statusLP() (PrinterState, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), lpstatTimeout)
+	defer cancel()
+
+	name := p.Name
+	if name == "" {
+		out, err := exec.CommandContext(ctx, "lpstat", "-d").CombinedOutput()
+		msg := strings.TrimSpace(string(out))
+		if err != nil {
+			return PrinterStateOffline, fmt.Sprintf("fail to run lpstat: %s %s", err.Error(), msg)
+		}
+
+		// system default destination: EPSON_TM
+		_, name, _ = strings.Cut(msg, "system default destination:")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return PrinterStateOffline, msg
+		}
+	}
+
+	out, err := exec.CommandContext(ctx, "lpstat", "-l", "-p", name).CombinedOutput()
+	if err != nil {
+		return PrinterStateOffline, fmt.Sprintf("fail to run lpstat: %s %s", err.Error(), strings.TrimSpace(string(out)))
+	}
+
+	return parseLPStat(name, string(out))
+}
+
+// parseLPStat parses lpstat -l -p output of a printer. CUPS reports paper condition as printer-state-reasons,
+// which is shown as Alerts field, and reason of disabled printer is shown in the line below printer status, e.g.
+//
+//	printer EPSON_TM disabled since Mon 01 Jan 2025 08:00:00 AM WIB -
+//		Paper out
+//		Description: EPSON TM-T82
+//		Alerts: media-empty-error offline-report
+func parseLPStat(name, out string) (PrinterState, string) {
+	var (
+		isFound    bool
+		isDisabled bool
+		message    string
+		alerts     []string
+	)
+
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "printer" || fields[1] != name {
+			continue
+		}
+		isFound = true
+		isDisabled = fields[2] == "disabled"
+
+		// fields of the printer are indented, until next printer
+		for _, detail := range lines[i+1:] {
+			if detail == "" || (detail[0] != ' ' && detail[0] != '\t') {
+				break
+			}
+			detail = strings.TrimSpace(detail)
+
+			key, value, isField := strings.Cut(detail, ":")
+			switch {
+			case isField && key == "Alerts":
+				alerts = strings.FieldsFunc(value, func(r rune) bool {
+					return r == ',' || r == ' ' || r == '\t'
+				})
+			case !isField && message == "":
+				// reason of disabled printer, the only line without field name
+				message = detail
+			}
+		}
+		break
+	}
+
+	if !isFound {
+		return PrinterStateOffline, fmt.Sprintf("printer %s not found", name)
+	}
+	if message == "" {
+		message = strings.Join(alerts, " ")
+	}
+
+	hasAlert := func(prefixes ...string) bool {
+		for _, alert := range alerts {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(alert, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case hasAlert("media-empty", "media-needed"):
+		return PrinterStatePaperOut, message
+	case isDisabled, hasAlert("offline"):
+		return PrinterStateOffline, message
+	case hasAlert("media-low"):
+		return PrinterStatePaperLow, message
+	}
+	return PrinterStateOnline, ""
+}
+
+// printFile prints lines to pdf file inside printer directory
+func (p *Printer) printFile() error {
+	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+		return fmt.Errorf("fail to create printer directory: %w", err)
+	}
+
+	// unique name, so tickets printed in the same millisecond don't overwrite each other
+	out, err := os.CreateTemp(p.Dir, time.Now().Format("20060102_150405")+"_*.pdf")
+	if err != nil {
+		return fmt.Errorf("fail to create ticket file: %w", err)
+	}
+	out.Close()
+
+	return p.printPDF(out.Name())
+}
+
+// WritePDF writes lines as pdf to w regardless whether printer is enabled.
+func (p *Printer) WritePDF(w io.Writer) error {
+	return p.newPDF().Output(w)
+}
+
+// WritePNG writes lines as rasterized png to w regardless whether printer is enabled.
+// It requires pdftoppm (poppler-utils) to be installed at server.
+func (p *Printer) WritePNG(w io.Writer) error {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		return fmt.Errorf("png preview requires pdftoppm from poppler-utils: %w", err)
+	}
+
+	var pdf bytes.Buffer
+	if err := p.WritePDF(&pdf); err != nil {
+		return err
+	}
+
+	// 203 dpi is the common resolution of thermal receipt printers
+	cmd := exec.Command("pdftoppm", "-png", "-r", "203", "-singlefile", "-", "-")
+	cmd.Stdin = &pdf
+	cmd.Stdout = w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("fail to rasterize pdf: %w", err)
+	}
+
+	return nil
+}
+
 // other methods such as POS printer, IPP printer can be added here
 
 const (
@@ -177,6 +554,10 @@ const (
 )
 
 func (p *Printer) printPDF(outPath string) error {
+	return p.newPDF().OutputFileAndClose(outPath)
+}
+
+func (p *Printer) newPDF() *gofpdf.Fpdf {
 	pdf := gofpdf.NewCustom(&gofpdf.InitType{
 		OrientationStr: gofpdf.OrientationPortrait,
 		UnitStr:        gofpdf.UnitMillimeter,
@@ -186,13 +567,10 @@ func (p *Printer) printPDF(outPath string) error {
 		},
 	})
 
-	pdf.AddPage()
-
-	// tackle weird behavior it automatically set (x,y) to (10.00125, 10.00125)
-	pdf.SetXY(0, 0)
+	p.fonts.add(pdf)
 
 	// mandatory as fallback
-	pdf.SetFont(defaultFont, "", defaultFontSize)
+	pdf.SetFont(p.fonts.Family, "", defaultFontSize)
 
 	// mandatory to make center alignment work properly
 	pdf.SetMargins(0, 0, 0)
@@ -201,29 +579,46 @@ func (p *Printer) printPDF(outPath string) error {
 	// idk why
 	pdf.SetAutoPageBreak(false, 0)
 
-	for _, l := range p.lines {
+	// wrap long text, then extend the page to fit wrapped text and codes
+	height := pageHeight
+	texts := make([][]string, len(p.lines))
+	for i, l := range p.lines {
+		switch l.Content {
+		case contentText:
+			p.setLineFont(pdf, l)
+			texts[i] = splitText(pdf, l.Text, pageWidth)
+			height += float64(len(texts[i])-1) * pointToMilimeter(float64(l.Size.Point))
+		case contentQRCode, contentBarcode:
+			height += l.CodeHeight
+		}
+	}
+
+	pdf.AddPageFormat(gofpdf.OrientationPortrait, gofpdf.SizeType{
+		Wd: pageWidth,
+		Ht: height,
+	})
+
+	// tackle weird behavior it automatically set (x,y) to (10.00125, 10.00125)
+	pdf.SetXY(0, 0)
+
+	for i, l := range p.lines {
 		switch l.Content {
 		case contentText:
 			// set font according to line
-			style := ""
-			if l.Style.Bold {
-				style += "B"
-			}
-			if l.Style.Underline {
-				style += "U"
+			p.setLineFont(pdf, l)
+
+			for _, text := range texts[i] {
+				pdf.CellFormat(
+					pageWidth,
+					pointToMilimeter(float64(l.Size.Point)),
+					text,
+					border,
+					line,
+					alignment,
+					fill,
+					0, "",
+				)
 			}
-			pdf.SetFont(defaultFont, style, float64(l.Size.Point))
-
-			pdf.CellFormat(
-				pageWidth,
-				pointToMilimeter(float64(l.Size.Point)),
-				l.Text,
-				border,
-				line,
-				alignment,
-				fill,
-				0, "",
-			)
 
 		case contentImage:
 			pdf.ImageOptions(
@@ -234,6 +629,14 @@ func (p *Printer) printPDF(outPath string) error {
 				gofpdf.ImageOptions{},
 				0, "",
 			)
+
+		case contentQRCode:
+			code, err := qr.Encode(l.Code, qr.M, qr.Auto)
+			addCode(pdf, fmt.Sprintf("code%d", i), code, err, l)
+
+		case contentBarcode:
+			code, err := code128.Encode(l.Code)
+			addCode(pdf, fmt.Sprintf("code%d", i), code, err, l)
 		}
 
 		// if call pdf.Ln(0), then next line directly printed below the previous line
@@ -245,7 +648,92 @@ func (p *Printer) printPDF(outPath string) error {
 		pdf.Ln(pointToMilimeter(float64(defaultSpacing * sn)))
 	}
 
-	return pdf.OutputFileAndClose(outPath)
+	return pdf
+}
+
+// codeScale is pixels per module of QR code and barcode image, so it stays sharp when stretched to line size
+const codeScale = 4
+
+// addCode puts QR code or barcode image centered on current line. The image is registered to this pdf only,
+// unlike gofpdf barcode contrib which keeps every code in a global cache.
+func addCode(pdf *gofpdf.Fpdf, name string, code barcode.Barcode, err error, l printerLine) {
+	if err != nil {
+		pdf.SetError(fmt.Errorf("fail to encode %s: %w", l.Content, err))
+		return
+	}
+
+	bounds := code.Bounds()
+	scaled, err := barcode.Scale(code, bounds.Dx()*codeScale, bounds.Dy()*codeScale)
+	if err != nil {
+		pdf.SetError(fmt.Errorf("fail to scale %s: %w", l.Content, err))
+		return
+	}
+
+	// barcode images are 16-bit gray, which gofpdf doesn't support
+	gray := image.NewGray(scaled.Bounds())
+	draw.Draw(gray, gray.Bounds(), scaled, scaled.Bounds().Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gray); err != nil {
+		pdf.SetError(fmt.Errorf("fail to encode %s image: %w", l.Content, err))
+		return
+	}
+
+	options := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader(name, options, &buf)
+	pdf.ImageOptions(name, (pageWidth-l.CodeWidth)/2, 0, l.CodeWidth, l.CodeHeight, true, options, 0, "")
+}
+
+func (p *Printer) setLineFont(pdf *gofpdf.Fpdf, l printerLine) {
+	family := l.Font
+	if family == "" {
+		family = p.fonts.Family
+	}
+
+	style := ""
+	if l.Style.Bold {
+		style += "B"
+	}
+	if l.Style.Underline {
+		style += "U"
+	}
+	pdf.SetFont(family, style, float64(l.Size.Point))
+}
+
+// splitText wraps text by words so each line fits within width using current font.
+// pdf.SplitText can't be used since it doesn't support UTF-8 font.
+func splitText(pdf *gofpdf.Fpdf, text string, width float64) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if pdf.GetStringWidth(candidate) <= width {
+			current = candidate
+			continue
+		}
+
+		if current != "" {
+			lines = append(lines, current)
+		}
+
+		// word itself is longer than width, break by characters
+		current = ""
+		for _, r := range word {
+			if current != "" && pdf.GetStringWidth(current+string(r)) > width {
+				lines = append(lines, current)
+				current = ""
+			}
+			current += string(r)
+		}
+	}
+
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
 }
 
 func pointToMilimeter(point float64) float64 {
@@ -0,0 +1,80 @@
+package models
+
+import "testing"
+
+func TestParseLPStat(t *testing.T) {
+	tests := []struct {
+		name        string
+		out         string
+		wantState   PrinterState
+		wantMessage string
+	}{
+		{
+			name: "idle",
+			out: "printer EPSON_TM is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n" +
+				"\tAlerts: none\n" +
+				"\tDescription: EPSON TM-T82\n",
+			wantState: PrinterStateOnline,
+		},
+		{
+			name: "paper out",
+			out: "printer EPSON_TM is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n" +
+				"\tAlerts: media-empty-error, media-needed\n",
+			wantState:   PrinterStatePaperOut,
+			wantMessage: "media-empty-error media-needed",
+		},
+		{
+			name: "paper low",
+			out: "printer EPSON_TM is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n" +
+				"\tAlerts: media-low-report\n",
+			wantState:   PrinterStatePaperLow,
+			wantMessage: "media-low-report",
+		},
+		{
+			name: "disabled with reason",
+			out: "printer EPSON_TM disabled since Mon 01 Jan 2025 08:00:00 AM WIB -\n" +
+				"\tPaper jam\n" +
+				"\tAlerts: none\n",
+			wantState:   PrinterStateOffline,
+			wantMessage: "Paper jam",
+		},
+		{
+			name: "offline alert",
+			out: "printer EPSON_TM is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n" +
+				"    Alerts: offline-report\n",
+			wantState:   PrinterStateOffline,
+			wantMessage: "offline-report",
+		},
+		{
+			// alerts of other printers don't affect the status
+			name: "other printer",
+			out: "printer OTHER is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n" +
+				"\tAlerts: media-empty-error\n" +
+				"printer EPSON_TM is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n" +
+				"\tAlerts: none\n",
+			wantState: PrinterStateOnline,
+		},
+		{
+			name:        "not found",
+			out:         "printer OTHER is idle.  enabled since Mon 01 Jan 2025 08:00:00 AM WIB\n",
+			wantState:   PrinterStateOffline,
+			wantMessage: "printer EPSON_TM not found",
+		},
+		{
+			name:        "empty output",
+			out:         "",
+			wantState:   PrinterStateOffline,
+			wantMessage: "printer EPSON_TM not found",
+		},
+	}
+
+	for _, tt := range tests {
+		state, message := parseLPStat("EPSON_TM", tt.out)
+		if state != tt.wantState {
+			t.Errorf("%s: expected state %s, got %s", tt.name, tt.wantState, state)
+		}
+		if message != tt.wantMessage {
+			t.Errorf("%s: expected message %q, got %q", tt.name, tt.wantMessage, message)
+		}
+	}
+}
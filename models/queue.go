@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/beego/beego/v2/core/logs"
+	"github.com/redis/go-redis/v9"
 	"github.com/tommywijayac/duck-queue-server-v2/databases"
 )
 
@@ -20,27 +21,34 @@ type Queue struct {
 type QueueConfig struct {
 	// how many queue numbers can be in queue at a time
 	MaxQueue int
-	// how many digits the queue number has
-	NumberLen int
-	// whether to pad queue number with leading zeroes
-	IsPadZeroes bool
+	// how many queue numbers can be created in a business day, 0 means unlimited
+	DailyLimit int
 }
 
+var (
+	// queue has reached MaxQueue, until some queue numbers leave it
+	ErrQueueFull = errors.New("queue is full")
+	// queue has reached DailyLimit, until next business day
+	ErrQueueFullToday = errors.New("daily queue limit reached")
+)
+
 var DefaultQueueCfg = QueueConfig{
-	MaxQueue:    1000,
-	NumberLen:   3,
-	IsPadZeroes: true,
+	MaxQueue: 1000,
 }
 
 // stored in redis
 type QueueItem struct {
 	QueueInfo
 	Number string `json:"number"`
+	// estimated wait in seconds, only for tickets waiting in main queue
+	EstimatedWait int `json:"estimated_wait,omitempty"`
 }
 
 type QueueInfo struct {
 	Name  string `json:"name,omitempty"`
 	Phone string `json:"phone,omitempty"`
+	// priority class, decides queue number prefix
+	Priority string `json:"priority,omitempty"`
 }
 
 func NewQueue(id string, cfg QueueConfig) *Queue {
@@ -51,29 +59,58 @@ func NewQueue(id string, cfg QueueConfig) *Queue {
 }
 
 // Queue Item methods
-func (q *Queue) Create(ctx context.Context, roomID string, info QueueInfo) (QueueItem, error) {
+func (q *Queue) Create(ctx context.Context, numbering QueueNumbering, info QueueInfo) (QueueItem, error) {
+	return q.CreateBefore(ctx, numbering, info, "")
+}
+
+// CreateBefore creates a new queue number and inserts it before pivot queue number.
+// It's appended to the queue if pivot is empty or no longer in queue.
+func (q *Queue) CreateBefore(ctx context.Context, numbering QueueNumbering, info QueueInfo, pivot string) (QueueItem, error) {
 	var err error
 
 	keys := q.getKeys()
 
-	// get sequence and generate queue number
-	// there is a small chance of race condition since we execute command separately
-	// but let's leave it to the field guys	to deal with it
-	err = databases.Redis.Incr(ctx, keys["seq"])
+	length, err := q.Len(ctx)
 	if err != nil {
 		return QueueItem{}, err
 	}
+	if length >= q.MaxQueue {
+		return QueueItem{}, ErrQueueFull
+	}
 
-	seq, err := databases.Redis.Get(ctx, keys["seq"])
-	if err != nil {
-		return QueueItem{}, err
+	if _, ok := numbering.PriorityPrefixes[info.Priority]; info.Priority != "" && !ok {
+		return QueueItem{}, ErrUnknownPriority
 	}
 
-	number, err := q.generateQueueNumber(string(seq.([]uint8)))
-	if err != nil {
-		return QueueItem{}, err
+	// get sequence and generate queue number. Once numbers wrap around, the number may still be
+	// in queue from its previous round, then it's skipped so tickets don't share a number.
+	var number string
+	for skipped := 0; ; skipped++ {
+		sequence, err := q.nextSequence(ctx, numbering)
+		if err != nil {
+			return QueueItem{}, err
+		}
+
+		number, err = numbering.Format(sequence, info.Priority)
+		if err != nil {
+			return QueueItem{}, err
+		}
+		if !numbering.isWrapped(sequence) {
+			break
+		}
+
+		isInUse, err := isNumberInUse(ctx, number)
+		if err != nil {
+			return QueueItem{}, err
+		}
+		if !isInUse {
+			break
+		}
+		if skipped >= numbering.count() {
+			// every number is in use
+			return QueueItem{}, ErrQueueNumberExceeded
+		}
 	}
-	number = roomID + number
 
 	// store queue info
 	if err := q.createInfo(ctx, number, info); err != nil {
@@ -81,15 +118,24 @@ func (q *Queue) Create(ctx context.Context, roomID string, info QueueInfo) (Queu
 	}
 
 	// insert to queue
-	res := databases.RedisClient.RPush(ctx, keys["base"], number)
-	if res.Err() != nil {
-		return QueueItem{}, res.Err()
+	var inserted int64
+	if pivot != "" {
+		res := databases.RedisClient.LInsertBefore(ctx, keys["base"], pivot, number)
+		if res.Err() != nil {
+			return QueueItem{}, res.Err()
+		}
+		inserted = res.Val()
+	}
+	if inserted <= 0 {
+		res := databases.RedisClient.RPush(ctx, keys["base"], number)
+		if res.Err() != nil {
+			return QueueItem{}, res.Err()
+		}
 	}
 
 	// update all keys TTL to 18 hours
 	expiration := 18 * time.Hour
 	databases.RedisClient.Expire(ctx, keys["base"], expiration)
-	databases.RedisClient.Expire(ctx, keys["seq"], expiration)
 	databases.RedisClient.Expire(ctx, keys["info"], expiration)
 
 	return QueueItem{
@@ -98,6 +144,60 @@ func (q *Queue) Create(ctx context.Context, roomID string, info QueueInfo) (Queu
 	}, nil
 }
 
+// nextSequenceScript increments sequence unless it has reached the limit, atomically so concurrent requests
+// get distinct sequences and rejected requests don't use up numbers. It returns 0 if the limit is reached.
+var nextSequenceScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local seq = tonumber(redis.call('GET', KEYS[1]) or '0')
+if limit > 0 and seq >= limit then
+	return 0
+end
+seq = redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return seq
+`)
+
+// nextSequence returns sequence of the next queue number today, limited by DailyLimit and numbers available
+func (q *Queue) nextSequence(ctx context.Context, numbering QueueNumbering) (int64, error) {
+	limit, limitErr := q.DailyLimit, ErrQueueFullToday
+	if capacity := numbering.Capacity(); capacity > 0 && (limit <= 0 || capacity < limit) {
+		limit, limitErr = capacity, ErrQueueNumberExceeded
+	}
+
+	expiration := 18 * time.Hour
+	sequence, err := nextSequenceScript.Run(ctx, databases.RedisClient, []string{q.getKeys()["seq"]},
+		limit, int(expiration.Seconds())).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if sequence == 0 {
+		return 0, limitErr
+	}
+
+	return sequence, nil
+}
+
+// isNumberInUse returns whether queue number is in any queue today. Tickets can be moved to other rooms,
+// so queues of all rooms are checked.
+func isNumberInUse(ctx context.Context, number string) (bool, error) {
+	keys, err := scanKeys(ctx, "queue:*:"+businessDayKey(time.Now()))
+	if err != nil {
+		return false, err
+	}
+
+	for _, key := range keys {
+		err := databases.RedisClient.LPos(ctx, key, number, redis.LPosArgs{}).Err()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
 func (q *Queue) Move(ctx context.Context, queueNumber string, destination *Queue) error {
 	sourceKeys := q.getKeys()
 	destKeys := destination.getKeys()
@@ -108,7 +208,7 @@ func (q *Queue) Move(ctx context.Context, queueNumber string, destination *Queue
 		return destLenRes.Err()
 	}
 	if destLenRes.Val() >= int64(destination.MaxQueue) {
-		return errors.New("destination queue is full")
+		return ErrQueueFull
 	}
 
 	// check & remove queue number from source queue
@@ -129,15 +229,80 @@ func (q *Queue) Move(ctx context.Context, queueNumber string, destination *Queue
 	return nil
 }
 
+// Len returns number of queue numbers in queue
+func (q *Queue) Len(ctx context.Context) (int, error) {
+	keys := q.getKeys()
+
+	res := databases.RedisClient.LLen(ctx, keys["base"])
+	if res.Err() != nil {
+		return 0, res.Err()
+	}
+
+	return int(res.Val()), nil
+}
+
+// Issued returns number of queue numbers created today
+func (q *Queue) Issued(ctx context.Context) (int, error) {
+	keys := q.getKeys()
+
+	issued, err := databases.RedisClient.Get(ctx, keys["seq"]).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return issued, err
+}
+
+// Numbers returns queue numbers in queue, first in line first
+func (q *Queue) Numbers(ctx context.Context) ([]string, error) {
+	keys := q.getKeys()
+
+	res := databases.RedisClient.LRange(ctx, keys["base"], 0, -1)
+	if res.Err() != nil {
+		return nil, res.Err()
+	}
+
+	return res.Val(), nil
+}
+
+// Position returns 0-based position of queue number in queue. It returns -1 if queue number is not in queue.
+func (q *Queue) Position(ctx context.Context, queueNumber string) (int, error) {
+	keys := q.getKeys()
+
+	res := databases.RedisClient.LPos(ctx, keys["base"], queueNumber, redis.LPosArgs{})
+	if res.Err() == redis.Nil {
+		return -1, nil
+	}
+	if res.Err() != nil {
+		return 0, res.Err()
+	}
+
+	return int(res.Val()), nil
+}
+
+// Peek returns the first queue number without removing it. It returns empty string if queue is empty.
+func (q *Queue) Peek(ctx context.Context) (string, error) {
+	keys := q.getKeys()
+
+	res := databases.RedisClient.LIndex(ctx, keys["base"], 0)
+	if res.Err() == redis.Nil {
+		return "", nil
+	}
+	if res.Err() != nil {
+		return "", res.Err()
+	}
+
+	return res.Val(), nil
+}
+
 func (q *Queue) getKeys() map[string]string {
-	// queue:{queue id}:{YYYYMMDD}
+	// queue:{queue id}:{YYYYMMDD}, date is business day so numbering restarts at cutover hour
 	//
 	// example values for room id "A", which has 2 counters, on Jan 1st, 2025
 	// - queue:A:counter:1:20250101
 	// - queue:A:counter:2:20250101
 	// - queue:A:main:20250101
 	// - queue:A:skip:20250101
-	base := fmt.Sprintf("queue:%s:%s", q.id, time.Now().Format("20060102"))
+	base := fmt.Sprintf("queue:%s:%s", q.id, businessDayKey(time.Now()))
 
 	return map[string]string{
 		"base": base,
@@ -145,25 +310,6 @@ func (q *Queue) getKeys() map[string]string {
 	}
 }
 
-func (q *Queue) generateQueueNumber(sequence string) (string, error) {
-	var result string
-
-	if len(sequence) > q.NumberLen-1 {
-		return "", errors.New("max daily generated number exceeded")
-	}
-
-	if q.IsPadZeroes {
-		for i := 0; i < q.NumberLen-len(sequence); i++ {
-			result += "0"
-		}
-		result += sequence
-
-		return result, nil
-	} else {
-		return sequence, nil
-	}
-}
-
 func (q *Queue) List(ctx context.Context) ([]QueueItem, error) {
 	keys := q.getKeys()
 
@@ -208,6 +354,11 @@ func (q *Queue) createInfo(ctx context.Context, queueNumber string, info QueueIn
 }
 
 func (q *Queue) getInfo(ctx context.Context, queueNumber string) (QueueInfo, error) {
+	return getQueueInfo(ctx, queueNumber)
+}
+
+// getQueueInfo returns info of queue number. Info is kept by queue number regardless of which queue it's in.
+func getQueueInfo(ctx context.Context, queueNumber string) (QueueInfo, error) {
 	res, err := databases.Redis.Get(ctx, getInfoKey(queueNumber))
 	if err != nil {
 		return QueueInfo{}, err
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+// RateLimiter limits requests per key in fixed windows. Counters are kept in redis,
+// so the limit holds across instances in multi node mode.
+type RateLimiter struct {
+	name   string
+	limit  int
+	window time.Duration
+}
+
+func NewRateLimiter(name string, limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		name:   name,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow counts a request of the key. If the limit is reached, it returns false and duration until the window resets.
+func (rl *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if rl.limit <= 0 {
+		return true, 0, nil
+	}
+
+	now := time.Now()
+	windowStart := now.Truncate(rl.window)
+	// ratelimit:{name}:{key}:{window start unix}
+	redisKey := fmt.Sprintf("ratelimit:%s:%s:%d", rl.name, key, windowStart.Unix())
+
+	pipe := databases.RedisClient.TxPipeline()
+	incr := pipe.Incr(ctx, redisKey)
+	pipe.Expire(ctx, redisKey, rl.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+
+	if incr.Val() > int64(rl.limit) {
+		return false, windowStart.Add(rl.window).Sub(now), nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,380 @@
+package models
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DailyReport is throughput and timing of a day, per room and counter
+type DailyReport struct {
+	Date  string       `json:"date"`
+	Total ReportStats  `json:"total"`
+	Rooms []RoomReport `json:"rooms"`
+}
+
+type RoomReport struct {
+	RoomID   string      `json:"room_id"`
+	RoomName string      `json:"room_name"`
+	Stats    ReportStats `json:"stats"`
+	// tickets created and served per hour of day in business timezone, index is hour
+	HourlyCreated [24]int         `json:"hourly_created"`
+	HourlyServed  [24]int         `json:"hourly_served"`
+	Counters      []CounterReport `json:"counters"`
+}
+
+type CounterReport struct {
+	CounterID   string      `json:"counter_id"`
+	CounterName string      `json:"counter_name"`
+	Stats       ReportStats `json:"stats"`
+}
+
+type ReportStats struct {
+	Created int `json:"created"`
+	Served  int `json:"served"`
+	Skipped int `json:"skipped"`
+	// skipped and never served again on the same day
+	NoShows     int `json:"no_shows"`
+	Transferred int `json:"transferred"`
+	Calls       int `json:"calls"`
+	Recalls     int `json:"recalls"`
+	// from entering main queue until served at counter
+	Wait DurationStats `json:"wait"`
+	// from served at counter until skipped or transferred
+	Service DurationStats `json:"service"`
+}
+
+// DurationStats summarizes durations, in seconds
+type DurationStats struct {
+	Count  int `json:"count"`
+	Avg    int `json:"avg"`
+	Median int `json:"median"`
+	P90    int `json:"p90"`
+}
+
+// DailyReportBuilder aggregates ticket journeys and call logs of a day into DailyReport
+type DailyReportBuilder struct {
+	date  time.Time
+	rooms map[string]RoomDetail
+
+	stats         map[reportKey]*reportAcc
+	hourlyCreated map[string]*[24]int
+	hourlyServed  map[string]*[24]int
+}
+
+// reportKey identifies stats of a room (empty counter id) or a room counter
+type reportKey struct {
+	roomID    string
+	counterID string
+}
+
+type reportAcc struct {
+	ReportStats
+	waits    []time.Duration
+	services []time.Duration
+}
+
+func NewDailyReportBuilder(date time.Time, rooms map[string]RoomDetail) *DailyReportBuilder {
+	return &DailyReportBuilder{
+		date:          BusinessDate(date),
+		rooms:         rooms,
+		stats:         make(map[reportKey]*reportAcc),
+		hourlyCreated: make(map[string]*[24]int),
+		hourlyServed:  make(map[string]*[24]int),
+	}
+}
+
+// AddJourney aggregates journey of a ticket, entries must be sorted oldest first.
+// Ticket is counted as served once per room, when the serving completes, i.e. it's not skipped afterwards.
+func (b *DailyReportBuilder) AddJourney(entries []TicketJourneyEntry) {
+	var (
+		roomID string
+		// zero if ticket is not waiting in main queue
+		waitingSince time.Time
+		// zero if ticket is not being served
+		servingSince   time.Time
+		servingCounter string
+		lastAction     TicketAction
+		lastCounter    string
+		// last process entry, nil if it's skipped since
+		serving *TicketJourneyEntry
+	)
+
+	completeServing := func() {
+		if serving == nil {
+			return
+		}
+		for _, acc := range b.accs(serving.RoomID, serving.CounterID) {
+			acc.Served++
+		}
+		b.hourly(b.hourlyServed, serving.RoomID)[serving.Timestamp.In(businessLoc).Hour()]++
+		serving = nil
+	}
+
+	for _, entry := range entries {
+		switch entry.Action {
+		case TicketActionCreate:
+			roomID = entry.RoomID
+			waitingSince = entry.Timestamp
+			b.acc(roomID, "").Created++
+			b.hourly(b.hourlyCreated, roomID)[entry.Timestamp.In(businessLoc).Hour()]++
+
+		case TicketActionProcess:
+			roomID = entry.RoomID
+			if !waitingSince.IsZero() {
+				for _, acc := range b.accs(roomID, entry.CounterID) {
+					acc.waits = append(acc.waits, entry.Timestamp.Sub(waitingSince))
+				}
+			}
+			// reprocessed, e.g. at other counter, is still served once
+			serving = &entry
+			waitingSince = time.Time{}
+			servingSince = entry.Timestamp
+			servingCounter = entry.CounterID
+
+		case TicketActionSkip:
+			for _, acc := range b.accs(entry.RoomID, servingCounter) {
+				acc.Skipped++
+				if !servingSince.IsZero() {
+					acc.services = append(acc.services, entry.Timestamp.Sub(servingSince))
+				}
+			}
+			lastCounter = servingCounter
+			servingSince = time.Time{}
+			servingCounter = ""
+			serving = nil
+
+		case TicketActionMove:
+			completeServing()
+			for _, acc := range b.accs(entry.FromRoomID, servingCounter) {
+				acc.Transferred++
+				if !servingSince.IsZero() {
+					acc.services = append(acc.services, entry.Timestamp.Sub(servingSince))
+				}
+			}
+			roomID = entry.RoomID
+			waitingSince = entry.Timestamp
+			servingSince = time.Time{}
+			servingCounter = ""
+
+		default:
+			// calls are counted from call logs
+			continue
+		}
+		lastAction = entry.Action
+	}
+	completeServing()
+
+	if lastAction == TicketActionSkip {
+		for _, acc := range b.accs(roomID, lastCounter) {
+			acc.NoShows++
+		}
+	}
+}
+
+// AddCallLogs aggregates calls of a room. Calling the same number at the same counter again counts as recall.
+func (b *DailyReportBuilder) AddCallLogs(roomID string, jobs []CallJob) {
+	type callKey struct {
+		number    string
+		counterID string
+	}
+
+	called := make(map[callKey]bool)
+	for _, job := range jobs {
+		key := callKey{number: job.QueueNumber, counterID: job.CounterID}
+		for _, acc := range b.accs(roomID, job.CounterID) {
+			acc.Calls++
+			if called[key] {
+				acc.Recalls++
+			}
+		}
+		called[key] = true
+	}
+}
+
+func (b *DailyReportBuilder) Build() DailyReport {
+	report := DailyReport{
+		Date:  b.date.Format("2006-01-02"),
+		Rooms: []RoomReport{},
+	}
+
+	// configured rooms are always reported, rooms no longer configured only if they have data
+	roomIDs := make(map[string]bool)
+	for roomID := range b.rooms {
+		roomIDs[roomID] = true
+	}
+	for key := range b.stats {
+		roomIDs[key.roomID] = true
+	}
+
+	var totalAcc reportAcc
+	for _, roomID := range slices.Sorted(maps.Keys(roomIDs)) {
+		detail := b.rooms[roomID]
+		roomReport := RoomReport{
+			RoomID:   roomID,
+			RoomName: detail.Name,
+			Stats:    b.acc(roomID, "").build(),
+			Counters: []CounterReport{},
+		}
+		if hourly, ok := b.hourlyCreated[roomID]; ok {
+			roomReport.HourlyCreated = *hourly
+		}
+		if hourly, ok := b.hourlyServed[roomID]; ok {
+			roomReport.HourlyServed = *hourly
+		}
+
+		counterIDs := make(map[string]bool)
+		for counterID := range detail.Counters {
+			counterIDs[counterID] = true
+		}
+		for key := range b.stats {
+			if key.roomID == roomID && key.counterID != "" {
+				counterIDs[key.counterID] = true
+			}
+		}
+		for _, counterID := range slices.Sorted(maps.Keys(counterIDs)) {
+			roomReport.Counters = append(roomReport.Counters, CounterReport{
+				CounterID:   counterID,
+				CounterName: detail.Counters[counterID].DisplayName,
+				Stats:       b.acc(roomID, counterID).build(),
+			})
+		}
+
+		totalAcc.add(b.acc(roomID, ""))
+		report.Rooms = append(report.Rooms, roomReport)
+	}
+	report.Total = totalAcc.build()
+
+	return report
+}
+
+// WriteCSV writes a row per room, followed by a row per counter of the room
+func (r DailyReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"date", "room_id", "room_name", "counter_id", "counter_name",
+		"created", "served", "skipped", "no_shows", "transferred", "calls", "recalls",
+		"wait_avg", "wait_median", "wait_p90", "service_avg", "service_median", "service_p90"}
+	for hour := 0; hour < 24; hour++ {
+		header = append(header, fmt.Sprintf("created_h%02d", hour))
+	}
+	for hour := 0; hour < 24; hour++ {
+		header = append(header, fmt.Sprintf("served_h%02d", hour))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, room := range r.Rooms {
+		row := append([]string{r.Date, room.RoomID, room.RoomName, "", ""}, room.Stats.csvColumns()...)
+		for _, n := range room.HourlyCreated {
+			row = append(row, strconv.Itoa(n))
+		}
+		for _, n := range room.HourlyServed {
+			row = append(row, strconv.Itoa(n))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+
+		for _, counter := range room.Counters {
+			row := append([]string{r.Date, room.RoomID, room.RoomName, counter.CounterID, counter.CounterName},
+				counter.Stats.csvColumns()...)
+			// hourly histogram is per room only
+			row = append(row, make([]string, 48)...)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s ReportStats) csvColumns() []string {
+	return []string{
+		strconv.Itoa(s.Created), strconv.Itoa(s.Served), strconv.Itoa(s.Skipped), strconv.Itoa(s.NoShows),
+		strconv.Itoa(s.Transferred), strconv.Itoa(s.Calls), strconv.Itoa(s.Recalls),
+		strconv.Itoa(s.Wait.Avg), strconv.Itoa(s.Wait.Median), strconv.Itoa(s.Wait.P90),
+		strconv.Itoa(s.Service.Avg), strconv.Itoa(s.Service.Median), strconv.Itoa(s.Service.P90),
+	}
+}
+
+func (b *DailyReportBuilder) acc(roomID, counterID string) *reportAcc {
+	key := reportKey{roomID: roomID, counterID: counterID}
+	acc, ok := b.stats[key]
+	if !ok {
+		acc = &reportAcc{}
+		b.stats[key] = acc
+	}
+	return acc
+}
+
+// accs returns stats of the room, and of the counter if known
+func (b *DailyReportBuilder) accs(roomID, counterID string) []*reportAcc {
+	if counterID == "" {
+		return []*reportAcc{b.acc(roomID, "")}
+	}
+	return []*reportAcc{b.acc(roomID, ""), b.acc(roomID, counterID)}
+}
+
+func (b *DailyReportBuilder) hourly(hourlies map[string]*[24]int, roomID string) *[24]int {
+	hourly, ok := hourlies[roomID]
+	if !ok {
+		hourly = &[24]int{}
+		hourlies[roomID] = hourly
+	}
+	return hourly
+}
+
+func (acc *reportAcc) add(other *reportAcc) {
+	acc.Created += other.Created
+	acc.Served += other.Served
+	acc.Skipped += other.Skipped
+	acc.NoShows += other.NoShows
+	acc.Transferred += other.Transferred
+	acc.Calls += other.Calls
+	acc.Recalls += other.Recalls
+	acc.waits = append(acc.waits, other.waits...)
+	acc.services = append(acc.services, other.services...)
+}
+
+func (acc *reportAcc) build() ReportStats {
+	stats := acc.ReportStats
+	stats.Wait = newDurationStats(acc.waits)
+	stats.Service = newDurationStats(acc.services)
+	return stats
+}
+
+func newDurationStats(durations []time.Duration) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return DurationStats{
+		Count:  len(sorted),
+		Avg:    int((total / time.Duration(len(sorted))).Seconds()),
+		Median: int(percentile(sorted, 0.5).Seconds()),
+		P90:    int(percentile(sorted, 0.9).Seconds()),
+	}
+}
+
+// percentile uses nearest rank method, sorted must not be empty
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
 )
 
 type Room struct {
@@ -20,12 +23,41 @@ type Room struct {
 	mainQueue    *Queue            // key is {room id}:main
 	counterQueue map[string]*Queue // room counter id -> queue number. key is {room id}:counter:{counter id}
 	skipQueue    *Queue            // key is {room id}:skip
+
+	serviceTime  *ServiceTimeTracker
+	appointments *AppointmentBook
 }
 
 type RoomDetail struct {
 	Name     string                       `json:"name"`
 	Actions  []RoomAllowedAction          `json:"actions"`
 	Counters map[string]RoomCounterDetail `json:"counters"`
+	// how queue numbers created in this room look
+	Numbering QueueNumbering `json:"numbering"`
+	Capacity  RoomCapacity   `json:"capacity"`
+	// when room accepts tickets, always if not set
+	Hours        OpeningHours      `json:"hours"`
+	Appointments AppointmentConfig `json:"appointments"`
+}
+
+// RoomCapacity limits tickets waiting in room main queue, whether created or moved from other room
+type RoomCapacity struct {
+	// tickets created per business day, 0 means only limited by numbering
+	DailyLimit int `json:"daily_limit"`
+	// tickets waiting at a time, default to 1000
+	MaxWaiting int `json:"max_waiting"`
+}
+
+// RoomCapacityStatus is how many more tickets the room accepts
+type RoomCapacityStatus struct {
+	DailyLimit int `json:"daily_limit"`
+	Issued     int `json:"issued"`
+	// tickets can still be created today, null if unlimited
+	RemainingToday *int `json:"remaining_today"`
+	MaxWaiting     int  `json:"max_waiting"`
+	Waiting        int  `json:"waiting"`
+	// tickets can still join main queue right now
+	RemainingWaiting int `json:"remaining_waiting"`
 }
 
 type RoomCounterDetail struct {
@@ -49,7 +81,27 @@ const (
 	InternalRoomIDDisplay = "DISPLAY"
 )
 
-func NewRoom(id string, detail RoomDetail) *Room {
+func NewRoom(id string, detail RoomDetail) (*Room, error) {
+	detail.Numbering = detail.Numbering.withDefaults(id)
+	if err := detail.Numbering.Validate(); err != nil {
+		return nil, fmt.Errorf("room %s: %w", id, err)
+	}
+	if detail.Capacity.DailyLimit < 0 || detail.Capacity.MaxWaiting < 0 {
+		return nil, fmt.Errorf("room %s: capacity must not be negative", id)
+	}
+	if detail.Capacity.MaxWaiting == 0 {
+		detail.Capacity.MaxWaiting = DefaultQueueCfg.MaxQueue
+	}
+	hours, err := detail.Hours.compile()
+	if err != nil {
+		return nil, fmt.Errorf("room %s: hours: %w", id, err)
+	}
+	detail.Hours = hours
+	detail.Appointments = detail.Appointments.withDefaults()
+	if err := detail.Appointments.Validate(); err != nil {
+		return nil, fmt.Errorf("room %s: %w", id, err)
+	}
+
 	counterQueue := make(map[string]*Queue)
 	for cid := range detail.Counters {
 		counterQueueCfg := DefaultQueueCfg
@@ -61,36 +113,328 @@ func NewRoom(id string, detail RoomDetail) *Room {
 		RoomDetail: detail,
 		Id:         id,
 
-		mainQueue:    NewQueue(id+":main", DefaultQueueCfg),
+		mainQueue: NewQueue(id+":main", QueueConfig{
+			MaxQueue:   detail.Capacity.MaxWaiting,
+			DailyLimit: detail.Capacity.DailyLimit,
+		}),
 		counterQueue: counterQueue,
 		skipQueue:    NewQueue(id+":skip", DefaultQueueCfg),
-	}
+
+		serviceTime:  NewServiceTimeTracker(id),
+		appointments: NewAppointmentBook(id, detail.Appointments),
+	}, nil
 }
 
 // CreateQueue creates a new queue. By default, it's appended to the main queue.
+// It returns RoomClosedError outside opening hours.
 func (r *Room) CreateQueue(ctx context.Context, info QueueInfo) (QueueItem, error) {
-	return r.mainQueue.Create(ctx, r.Id, info)
+	if status := r.GetOpenStatus(); !status.IsAcceptingTickets {
+		return QueueItem{}, &RoomClosedError{NextOpenAt: status.NextOpenAt}
+	}
+
+	return r.mainQueue.Create(ctx, r.Numbering, info)
+}
+
+// GetOpenStatus returns whether room is open now according to its opening hours
+func (r *Room) GetOpenStatus() RoomOpenStatus {
+	return r.Hours.Status(time.Now())
+}
+
+// BookAppointment books a slot of the room
+func (r *Room) BookAppointment(ctx context.Context, info QueueInfo, slotAt time.Time) (Appointment, error) {
+	return r.appointments.Book(ctx, r.Hours, info, slotAt)
+}
+
+// ListAppointments returns appointments of the business day, by slot
+func (r *Room) ListAppointments(ctx context.Context, date time.Time) ([]Appointment, error) {
+	return r.appointments.List(ctx, date)
+}
+
+// CheckInAppointment creates a queue for the appointment. If checked in within grace window of the slot,
+// it's placed after on time appointments already waiting, ahead of walk-ins. Otherwise, it's appended like a walk-in.
+func (r *Room) CheckInAppointment(ctx context.Context, appointment Appointment) (QueueItem, Appointment, error) {
+	if appointment.RoomID != r.Id {
+		return QueueItem{}, Appointment{}, ErrAppointmentNotFound
+	}
+	if appointment.CheckedInAt != nil {
+		return QueueItem{}, Appointment{}, ErrAppointmentCheckedIn
+	}
+
+	now := time.Now()
+	if !BusinessDate(appointment.SlotAt).Equal(BusinessDate(now)) {
+		return QueueItem{}, Appointment{}, ErrAppointmentNotToday
+	}
+	if status := r.GetOpenStatus(); !status.IsAcceptingTickets {
+		return QueueItem{}, Appointment{}, &RoomClosedError{NextOpenAt: status.NextOpenAt}
+	}
+
+	if err := r.appointments.ClaimCheckIn(ctx, appointment); err != nil {
+		return QueueItem{}, Appointment{}, err
+	}
+
+	isPriority := r.Appointments.IsOnTime(appointment.SlotAt, now)
+	queue, err := r.createAppointmentQueue(ctx, appointment, isPriority)
+	if err != nil {
+		if releaseErr := r.appointments.ReleaseCheckIn(ctx, appointment); releaseErr != nil {
+			logs.Error("failed to release check-in of appointment %s: %s", appointment.Code, releaseErr.Error())
+		}
+		return QueueItem{}, Appointment{}, err
+	}
+
+	appointment, err = r.appointments.CompleteCheckIn(ctx, appointment, queue.Number, isPriority)
+	if err != nil {
+		return QueueItem{}, Appointment{}, err
+	}
+
+	return queue, appointment, nil
+}
+
+func (r *Room) createAppointmentQueue(ctx context.Context, appointment Appointment, isPriority bool) (QueueItem, error) {
+	var pivot string
+	if isPriority {
+		numbers, err := r.mainQueue.Numbers(ctx)
+		if err != nil {
+			return QueueItem{}, err
+		}
+		isPriorities, err := r.appointments.IsPriority(ctx, numbers)
+		if err != nil {
+			return QueueItem{}, err
+		}
+
+		// first walk-in, appended if there is none
+		for i, number := range numbers {
+			if !isPriorities[i] {
+				pivot = number
+				break
+			}
+		}
+	}
+
+	return r.mainQueue.CreateBefore(ctx, r.Numbering, appointment.QueueInfo, pivot)
 }
 
 // ProcessQueue moves a queue from main OR skip queue to counter queue.
 func (r *Room) ProcessQueue(ctx context.Context, originQueue string, counterId, queueNumber string) error {
+	var err error
 	switch originQueue {
 	case "main":
-		return r.mainQueue.Move(ctx, queueNumber, r.counterQueue[counterId])
+		err = r.mainQueue.Move(ctx, queueNumber, r.counterQueue[counterId])
 	case "skip":
-		return r.skipQueue.Move(ctx, queueNumber, r.counterQueue[counterId])
+		err = r.skipQueue.Move(ctx, queueNumber, r.counterQueue[counterId])
+	default:
+		return errors.New("invalid origin queue")
 	}
-	return errors.New("invalid origin queue")
+	if err != nil {
+		return err
+	}
+
+	r.startService(ctx, counterId, queueNumber)
+	return nil
+}
+
+// ProcessNextQueue moves the first queue in main queue to counter queue.
+func (r *Room) ProcessNextQueue(ctx context.Context, counterId string) (string, error) {
+	queueNumber, err := r.mainQueue.Peek(ctx)
+	if err != nil {
+		return "", err
+	}
+	if queueNumber == "" {
+		return "", errors.New("main queue is empty")
+	}
+
+	if err := r.mainQueue.Move(ctx, queueNumber, r.counterQueue[counterId]); err != nil {
+		return "", err
+	}
+
+	r.startService(ctx, counterId, queueNumber)
+	return queueNumber, nil
+}
+
+// GetCounterQueue returns queue currently served at counter, if any.
+func (r *Room) GetCounterQueue(ctx context.Context, counterId string) (QueueItem, error) {
+	items, err := r.counterQueue[counterId].List(ctx)
+	if err != nil {
+		return QueueItem{}, err
+	}
+	if len(items) == 0 {
+		return QueueItem{}, errors.New("no queue at counter")
+	}
+
+	return items[0], nil
 }
 
 // SkipQueue moves a queue from counter queue to skip queue.
 func (r *Room) SkipQueue(ctx context.Context, counterId, queueNumber string) error {
-	return r.counterQueue[counterId].Move(ctx, queueNumber, r.skipQueue)
+	if err := r.counterQueue[counterId].Move(ctx, queueNumber, r.skipQueue); err != nil {
+		return err
+	}
+
+	r.finishService(ctx, counterId, queueNumber)
+	return nil
 }
 
 // MoveQueue moves a queue from counter queue to another room's main queue. It doesn't create a new queue number
 func (r *Room) MoveQueue(ctx context.Context, counterId, queueNumber string, destination *Room) error {
-	return r.counterQueue[counterId].Move(ctx, queueNumber, destination.mainQueue)
+	if err := r.counterQueue[counterId].Move(ctx, queueNumber, destination.mainQueue); err != nil {
+		return err
+	}
+
+	r.finishService(ctx, counterId, queueNumber)
+	return nil
+}
+
+// service time is only used for estimation, so failing to record it shouldn't fail the queue operation
+func (r *Room) startService(ctx context.Context, counterId, queueNumber string) {
+	if err := r.serviceTime.Start(ctx, counterId, queueNumber); err != nil {
+		logs.Error("failed to record service start of %s: %s", queueNumber, err.Error())
+	}
+}
+
+func (r *Room) finishService(ctx context.Context, counterId, queueNumber string) {
+	if err := r.serviceTime.Finish(ctx, counterId, queueNumber); err != nil {
+		logs.Error("failed to record service finish of %s: %s", queueNumber, err.Error())
+	}
+}
+
+// GetWaitEstimate estimates wait of a new ticket, based on rolling average service time and open counters
+func (r *Room) GetWaitEstimate(ctx context.Context) (WaitEstimate, error) {
+	stats, err := r.getServiceStats(ctx)
+	if err != nil {
+		return WaitEstimate{}, err
+	}
+
+	waiting, err := r.mainQueue.Len(ctx)
+	if err != nil {
+		return WaitEstimate{}, err
+	}
+
+	counterAvg := make(map[string]int, len(stats.CounterAvgService))
+	for counterId, avg := range stats.CounterAvgService {
+		counterAvg[counterId] = int(avg.Seconds())
+	}
+
+	return WaitEstimate{
+		AvgServiceSeconds: int(stats.AvgService.Seconds()),
+		CounterAvgSeconds: counterAvg,
+		OpenCounters:      stats.OpenCounters,
+		Waiting:           waiting,
+		WaitSeconds:       int(stats.EstimateWait(waiting).Seconds()),
+	}, nil
+}
+
+func (r *Room) getServiceStats(ctx context.Context) (ServiceStats, error) {
+	counterIds := make([]string, 0, len(r.counterQueue))
+	for counterId := range r.counterQueue {
+		counterIds = append(counterIds, counterId)
+	}
+	return r.serviceTime.Stats(ctx, counterIds)
+}
+
+// GetCapacity returns how many more tickets the room accepts, today and right now
+func (r *Room) GetCapacity(ctx context.Context) (RoomCapacityStatus, error) {
+	issued, err := r.mainQueue.Issued(ctx)
+	if err != nil {
+		return RoomCapacityStatus{}, err
+	}
+
+	waiting, err := r.mainQueue.Len(ctx)
+	if err != nil {
+		return RoomCapacityStatus{}, err
+	}
+
+	status := RoomCapacityStatus{
+		DailyLimit:       r.Capacity.DailyLimit,
+		Issued:           issued,
+		MaxWaiting:       r.Capacity.MaxWaiting,
+		Waiting:          waiting,
+		RemainingWaiting: max(r.Capacity.MaxWaiting-waiting, 0),
+	}
+
+	// the lower of daily limit and numbers available
+	for _, limit := range []int{r.Capacity.DailyLimit, r.Numbering.Capacity()} {
+		if limit <= 0 {
+			continue
+		}
+		remaining := max(limit-issued, 0)
+		if status.RemainingToday == nil || remaining < *status.RemainingToday {
+			status.RemainingToday = &remaining
+		}
+	}
+
+	return status, nil
+}
+
+// GetQueueLengths returns number of tickets per queue: main, skip and counter:{counter id}
+func (r *Room) GetQueueLengths(ctx context.Context) (map[string]int, error) {
+	lengths := make(map[string]int)
+
+	var err error
+	if lengths["main"], err = r.mainQueue.Len(ctx); err != nil {
+		return nil, err
+	}
+	if lengths["skip"], err = r.skipQueue.Len(ctx); err != nil {
+		return nil, err
+	}
+	for counterId, counterQueue := range r.counterQueue {
+		if lengths["counter:"+counterId], err = counterQueue.Len(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return lengths, nil
+}
+
+// FindTicket returns status of queue number in the room. It returns false if queue number is not in any room queue.
+func (r *Room) FindTicket(ctx context.Context, queueNumber string) (TicketStatus, bool, error) {
+	ticket := TicketStatus{
+		Number:   queueNumber,
+		RoomID:   r.Id,
+		RoomName: r.Name,
+	}
+
+	position, err := r.mainQueue.Position(ctx, queueNumber)
+	if err != nil {
+		return TicketStatus{}, false, err
+	}
+	if position >= 0 {
+		stats, err := r.getServiceStats(ctx)
+		if err != nil {
+			return TicketStatus{}, false, err
+		}
+
+		ticket.Status = TicketStateWaiting
+		ticket.Queue = "main"
+		ticket.Position = position + 1
+		ticket.Ahead = position
+		ticket.EstimatedWait = int(stats.EstimateWait(position).Seconds())
+		return ticket, true, nil
+	}
+
+	position, err = r.skipQueue.Position(ctx, queueNumber)
+	if err != nil {
+		return TicketStatus{}, false, err
+	}
+	if position >= 0 {
+		ticket.Status = TicketStateSkipped
+		ticket.Queue = "skip"
+		return ticket, true, nil
+	}
+
+	for counterId, counterQueue := range r.counterQueue {
+		position, err = counterQueue.Position(ctx, queueNumber)
+		if err != nil {
+			return TicketStatus{}, false, err
+		}
+		if position >= 0 {
+			ticket.Status = TicketStateServing
+			ticket.Queue = "counter"
+			ticket.CounterID = counterId
+			ticket.CounterName = r.Counters[counterId].DisplayName
+			return ticket, true, nil
+		}
+	}
+
+	return TicketStatus{}, false, nil
 }
 
 func (r *Room) GetQueues(ctx context.Context) (map[string][]QueueItem, error) {
@@ -100,6 +444,13 @@ func (r *Room) GetQueues(ctx context.Context) (map[string][]QueueItem, error) {
 	if err != nil {
 		return nil, err
 	}
+	stats, err := r.getServiceStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range mainItems {
+		mainItems[i].EstimatedWait = int(stats.EstimateWait(i).Seconds())
+	}
 	queues["main"] = mainItems
 
 	skipItems, err := r.skipQueue.List(ctx)
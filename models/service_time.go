@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/redis/go-redis/v9"
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+const (
+	// number of recent services per counter used for rolling average
+	serviceTimeWindow = 20
+	// counter which hasn't served anyone for this long is considered closed
+	counterIdleTimeout = 15 * time.Minute
+)
+
+// ServiceTimeTracker records how long tickets are served at room counters,
+// from entering counter queue until leaving it (skipped or moved to other room).
+type ServiceTimeTracker struct {
+	roomID string
+}
+
+type activeService struct {
+	Number    string    `json:"number"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type serviceSample struct {
+	Duration   time.Duration `json:"duration"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+// ServiceStats is rolling service time of a room
+type ServiceStats struct {
+	// average service duration of the room, zero if there is no sample yet
+	AvgService time.Duration
+	// average service duration per counter
+	CounterAvgService map[string]time.Duration
+	// counters serving a ticket or finished serving recently
+	OpenCounters int
+}
+
+// WaitEstimate is estimated wait of a room, in seconds
+type WaitEstimate struct {
+	AvgServiceSeconds int            `json:"avg_service_seconds"`
+	CounterAvgSeconds map[string]int `json:"counter_avg_service_seconds"`
+	OpenCounters      int            `json:"open_counters"`
+	Waiting           int            `json:"waiting"`
+	// wait of a new ticket, zero if there is not enough data to estimate
+	WaitSeconds int `json:"wait_seconds"`
+}
+
+func NewServiceTimeTracker(roomID string) *ServiceTimeTracker {
+	return &ServiceTimeTracker{
+		roomID: roomID,
+	}
+}
+
+// Start marks queue number started being served at counter
+func (st *ServiceTimeTracker) Start(ctx context.Context, counterID, queueNumber string) error {
+	activestr, err := json.Marshal(activeService{
+		Number:    queueNumber,
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	key := st.getActiveKey()
+	if err := databases.RedisClient.HSet(ctx, key, counterID, activestr).Err(); err != nil {
+		return err
+	}
+	return databases.RedisClient.Expire(ctx, key, 18*time.Hour).Err()
+}
+
+// Finish records service duration of queue number at counter
+func (st *ServiceTimeTracker) Finish(ctx context.Context, counterID, queueNumber string) error {
+	key := st.getActiveKey()
+
+	activestr, err := databases.RedisClient.HGet(ctx, key, counterID).Result()
+	if err == redis.Nil {
+		// started before tracking is enabled
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var active activeService
+	if err := json.Unmarshal([]byte(activestr), &active); err != nil {
+		return err
+	}
+	if active.Number != queueNumber {
+		return nil
+	}
+
+	now := time.Now()
+	samplestr, err := json.Marshal(serviceSample{
+		Duration:   now.Sub(active.StartedAt),
+		FinishedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	samplesKey := st.getSamplesKey(counterID)
+	pipe := databases.RedisClient.TxPipeline()
+	pipe.LPush(ctx, samplesKey, samplestr)
+	pipe.LTrim(ctx, samplesKey, 0, serviceTimeWindow-1)
+	pipe.HDel(ctx, key, counterID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Stats calculates rolling average service time of the room counters
+func (st *ServiceTimeTracker) Stats(ctx context.Context, counterIDs []string) (ServiceStats, error) {
+	stats := ServiceStats{
+		CounterAvgService: make(map[string]time.Duration),
+	}
+
+	active, err := databases.RedisClient.HGetAll(ctx, st.getActiveKey()).Result()
+	if err != nil {
+		return ServiceStats{}, err
+	}
+
+	now := time.Now()
+	var total time.Duration
+	var n int
+	for _, counterID := range counterIDs {
+		res, err := databases.RedisClient.LRange(ctx, st.getSamplesKey(counterID), 0, -1).Result()
+		if err != nil {
+			return ServiceStats{}, err
+		}
+
+		var counterTotal time.Duration
+		var lastFinishedAt time.Time
+		for i, samplestr := range res {
+			var sample serviceSample
+			if err := json.Unmarshal([]byte(samplestr), &sample); err != nil {
+				logs.Error("failed to unmarshal service sample: %s", err.Error())
+				continue
+			}
+			counterTotal += sample.Duration
+			// newest first
+			if i == 0 {
+				lastFinishedAt = sample.FinishedAt
+			}
+		}
+		if len(res) > 0 {
+			stats.CounterAvgService[counterID] = counterTotal / time.Duration(len(res))
+			total += counterTotal
+			n += len(res)
+		}
+
+		_, isServing := active[counterID]
+		if isServing || (!lastFinishedAt.IsZero() && now.Sub(lastFinishedAt) < counterIdleTimeout) {
+			stats.OpenCounters++
+		}
+	}
+
+	if n > 0 {
+		stats.AvgService = total / time.Duration(n)
+	}
+
+	return stats, nil
+}
+
+// EstimateWait estimates wait of the ticket at position (0-based) in main queue.
+// It returns zero if there is not enough data to estimate.
+func (s ServiceStats) EstimateWait(position int) time.Duration {
+	if s.AvgService == 0 {
+		return 0
+	}
+
+	openCounters := max(s.OpenCounters, 1)
+	return time.Duration(position+1) * s.AvgService / time.Duration(openCounters)
+}
+
+func (st *ServiceTimeTracker) getActiveKey() string {
+	// service:{room id}:active, counter id -> active service
+	return fmt.Sprintf("service:%s:active", st.roomID)
+}
+
+func (st *ServiceTimeTracker) getSamplesKey(counterID string) string {
+	// service:{room id}:counter:{counter id}, newest first
+	return fmt.Sprintf("service:%s:counter:%s", st.roomID, counterID)
+}
@@ -0,0 +1,31 @@
+package models
+
+type TicketState string
+
+const (
+	// waiting in main queue
+	TicketStateWaiting TicketState = "waiting"
+	// skipped by counter, waiting to be recalled
+	TicketStateSkipped TicketState = "skipped"
+	// being served at counter
+	TicketStateServing TicketState = "serving"
+)
+
+// TicketStatus is current state of a queue number, shown to the ticket holder.
+// It must not contain queue info, since it's publicly accessible by queue number.
+type TicketStatus struct {
+	Number   string      `json:"number"`
+	Status   TicketState `json:"status"`
+	RoomID   string      `json:"room_id"`
+	RoomName string      `json:"room_name"`
+	// main, skip or counter
+	Queue       string `json:"queue"`
+	CounterID   string `json:"counter_id,omitempty"`
+	CounterName string `json:"counter_name,omitempty"`
+	// 1-based position in main queue, only for waiting ticket
+	Position int `json:"position,omitempty"`
+	// number of tickets ahead in main queue, only for waiting ticket
+	Ahead int `json:"ahead"`
+	// estimated wait in seconds, only for waiting ticket
+	EstimatedWait int `json:"estimated_wait,omitempty"`
+}
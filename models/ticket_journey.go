@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/tommywijayac/duck-queue-server-v2/databases"
+)
+
+type TicketAction string
+
+const (
+	TicketActionCreate  TicketAction = "create"
+	TicketActionProcess TicketAction = "process"
+	TicketActionSkip    TicketAction = "skip"
+	TicketActionMove    TicketAction = "move"
+	TicketActionCall    TicketAction = "call"
+)
+
+// daily journey log is kept longer than ticket journey, so reports of previous days can be built
+const journeyLogRetention = 31 * 24 * time.Hour
+
+// TicketJourneyEntry is a step of ticket journey. Room, queue and counter are where the ticket is after the action.
+type TicketJourneyEntry struct {
+	// only set in daily journey log
+	Number string       `json:"number,omitempty"`
+	Action TicketAction `json:"action"`
+	RoomID string       `json:"room_id"`
+	// source room of move
+	FromRoomID string `json:"from_room_id,omitempty"`
+	Queue      string `json:"queue"`
+	CounterID  string `json:"counter_id,omitempty"`
+	// dispenser client id for create, counter id for counter actions
+	Actor     string    `json:"actor,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// seconds until next step, filled when listed. zero for the last step of finished ticket
+	Duration int `json:"duration,omitempty"`
+	// ticket info as created, only set for create. Queue info is keyed by queue number only,
+	// so it can't tell whose ticket it was on previous days.
+	Info *QueueInfo `json:"info,omitempty"`
+}
+
+// TicketJourney is append-only log of where a ticket has been, across rooms
+type TicketJourney struct {
+	number string
+}
+
+func NewTicketJourney(number string) *TicketJourney {
+	return &TicketJourney{
+		number: number,
+	}
+}
+
+func (tj *TicketJourney) Append(ctx context.Context, entry TicketJourneyEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	entrystr, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	entry.Number = tj.number
+	logstr, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	key := tj.getKey(entry.Timestamp)
+	logKey := getJourneyLogKey(entry.Timestamp)
+	pipe := databases.RedisClient.TxPipeline()
+	pipe.RPush(ctx, key, entrystr)
+	pipe.Expire(ctx, key, 18*time.Hour)
+	pipe.RPush(ctx, logKey, logstr)
+	pipe.Expire(ctx, logKey, journeyLogRetention)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// List returns journey entries, oldest first
+func (tj *TicketJourney) List(ctx context.Context) ([]TicketJourneyEntry, error) {
+	res, err := databases.RedisClient.LRange(ctx, tj.getKey(time.Now()), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]TicketJourneyEntry, 0, len(res))
+	for _, entrystr := range res {
+		var entry TicketJourneyEntry
+		if err := json.Unmarshal([]byte(entrystr), &entry); err != nil {
+			logs.Error("failed to unmarshal journey entry of ticket %s: %s", tj.number, err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	for i := 0; i < len(entries)-1; i++ {
+		entries[i].Duration = int(entries[i+1].Timestamp.Sub(entries[i].Timestamp).Seconds())
+	}
+
+	return entries, nil
+}
+
+// ListTicketJourneysByDate returns journey of all tickets with activity on the business day, by queue number, oldest first
+func ListTicketJourneysByDate(ctx context.Context, date time.Time) (map[string][]TicketJourneyEntry, error) {
+	res, err := databases.RedisClient.LRange(ctx, getJourneyLogKey(date), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	journeys := make(map[string][]TicketJourneyEntry)
+	for _, entrystr := range res {
+		var entry TicketJourneyEntry
+		if err := json.Unmarshal([]byte(entrystr), &entry); err != nil {
+			logs.Error("failed to unmarshal journey log: %s", err.Error())
+			continue
+		}
+		journeys[entry.Number] = append(journeys[entry.Number], entry)
+	}
+
+	// entries from multiple instances may be appended slightly out of order
+	for _, entries := range journeys {
+		slices.SortStableFunc(entries, func(a, b TicketJourneyEntry) int {
+			return a.Timestamp.Compare(b.Timestamp)
+		})
+	}
+
+	return journeys, nil
+}
+
+func getJourneyLogKey(date time.Time) string {
+	// ticket_journey:{YYYYMMDD}, all journey entries of the business day
+	return fmt.Sprintf("ticket_journey:%s", businessDayKey(date))
+}
+
+func (tj *TicketJourney) getKey(date time.Time) string {
+	// ticket:{queue number}:journey:{YYYYMMDD}, numbers restart every business day like queue keys
+	return fmt.Sprintf("ticket:%s:journey:%s", tj.number, businessDayKey(date))
+}
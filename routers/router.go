@@ -12,12 +12,35 @@ func Init() {
 	web.Router("/api/rooms/:id/skip", &controllers.RoomController{}, "post:SkipRoomQueue")
 	web.Router("/api/rooms/:id/move", &controllers.RoomController{}, "post:MoveRoomQueue")
 	web.Router("/api/rooms/:id/call", &controllers.RoomController{}, "post:CallRoomQueue")
+	web.Router("/api/rooms/:id/check-in", &controllers.RoomController{}, "post:CheckInAppointment")
+	web.Router("/api/rooms/:id/appointments", &controllers.AppointmentController{}, "post:BookAppointment")
 
 	web.Router("/api/rooms/:id/stream", &controllers.RoomController{}, "get:StreamRoomEvents")
+	web.Router("/api/rooms/:id/ws", &controllers.RoomController{}, "get:StreamRoomEventsWS")
+	web.Router("/api/stream", &controllers.RoomController{}, "get:StreamEvents")
 
 	web.Router("/api/dispenser/exit", &controllers.AdminController{}, "post:ExitDispenserApp")
 
+	web.Router("/api/admin/clients", &controllers.AdminController{}, "get:ListClients")
+	web.Router("/api/admin/clients/:client_id/disconnect", &controllers.AdminController{}, "post:DisconnectClient")
+	web.Router("/api/admin/clients/:client_id/reload", &controllers.AdminController{}, "post:ReloadClient")
+	web.Router("/api/admin/clients/:client_id/control", &controllers.AdminController{}, "post:ControlClientDisplay")
+	web.Router("/api/admin/rooms/:id/control", &controllers.AdminController{}, "post:ControlRoomDisplays")
+	web.Router("/api/admin/announcements", &controllers.AdminController{}, "get:ListAnnouncements;post:CreateAnnouncement")
+	web.Router("/api/admin/announcements/:announcement_id", &controllers.AdminController{}, "delete:DeleteAnnouncement")
+
 	// Query
 	web.Router("/api/rooms/:id", &controllers.RoomController{}, "get:GetRoomQueues")
-	// web.Router("/api/rooms", &controllers.RoomController{}, "get:ListRooms")
+	web.Router("/api/rooms", &controllers.RoomController{}, "get:ListRooms")
+	web.Router("/api/rooms/:id/appointments", &controllers.AdminController{}, "get:ListAppointments")
+	web.Router("/api/tickets/:number", &controllers.TicketController{}, "get:GetTicketStatus")
+	web.Router("/api/tickets/:number/history", &controllers.AdminController{}, "get:GetTicketHistory")
+	web.Router("/api/reports/daily", &controllers.AdminController{}, "get:GetDailyReport")
+	web.Router("/api/archive/days", &controllers.AdminController{}, "get:ListArchivedDays")
+	web.Router("/api/archive/days/:date/tickets", &controllers.AdminController{}, "get:ListArchivedTickets")
+	web.Router("/api/archive/days/:date/tickets/:number", &controllers.AdminController{}, "get:GetArchivedTicketHistory")
+	web.Router("/api/printer/preview", &controllers.PrinterController{}, "get:PreviewTicket")
+	web.Router("/api/printer/status", &controllers.PrinterController{}, "get:GetPrinterStatus")
+
+	web.Handler("/metrics", controllers.MetricsService.Handler())
 }
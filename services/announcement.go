@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+const (
+	AnnouncementActivated = "activated"
+	AnnouncementExpired   = "expired"
+
+	// expired announcements are kept for a while, so admin can still see them
+	announcementRetention = 24 * time.Hour
+
+	// only one instance checks at a time in multi node mode, pushes reach displays of all instances
+	announcementCheckLockKey = "announcements:check:lock"
+)
+
+type AnnouncementService struct {
+	store *models.AnnouncementStore
+
+	// dependencies
+	roomService     *RoomService
+	eventHubService *EventHubService
+}
+
+func NewAnnouncementService(roomService *RoomService, eventHubService *EventHubService) *AnnouncementService {
+	interval, err := web.AppConfig.Int("announcement::check_interval")
+	if err != nil || interval <= 0 {
+		interval = 5
+	}
+
+	as := &AnnouncementService{
+		store:           models.NewAnnouncementStore(),
+		roomService:     roomService,
+		eventHubService: eventHubService,
+	}
+
+	// start scheduler, which pushes announcements when activated or expired
+	go as.run(time.Duration(interval) * time.Second)
+
+	return as
+}
+
+func (as *AnnouncementService) Create(ctx context.Context, a models.Announcement) (models.Announcement, error) {
+	if err := a.Validate(); err != nil {
+		return models.Announcement{}, err
+	}
+
+	for _, roomId := range a.RoomIDs {
+		if roomId == models.InternalRoomIDDisplay {
+			continue
+		}
+		if _, err := as.roomService.GetRoom(ctx, roomId); err != nil {
+			return models.Announcement{}, err
+		}
+	}
+
+	created, err := as.store.Create(ctx, a)
+	if err != nil {
+		return models.Announcement{}, err
+	}
+
+	// push immediately instead of waiting for next check
+	as.check(ctx)
+
+	return created, nil
+}
+
+func (as *AnnouncementService) List(ctx context.Context) ([]models.Announcement, error) {
+	return as.store.List(ctx)
+}
+
+func (as *AnnouncementService) Delete(ctx context.Context, id string) error {
+	if err := as.store.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	as.check(ctx)
+	return nil
+}
+
+// ListActive returns announcements currently shown in the room, sorted by priority
+func (as *AnnouncementService) ListActive(ctx context.Context, roomId string) ([]models.Announcement, error) {
+	announcements, err := as.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]models.Announcement, 0)
+	for _, a := range announcements {
+		if a.IsActive(now) && a.IsTargeting(roomId) {
+			active = append(active, a)
+		}
+	}
+	return active, nil
+}
+
+func (as *AnnouncementService) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		as.check(context.Background())
+	}
+}
+
+// check compares active announcements with the ones last pushed, then pushes the difference.
+// Pushed state is kept in redis, so restarts and other instances don't push the same announcement again.
+func (as *AnnouncementService) check(ctx context.Context) {
+	// if another instance is checking, it pushes the difference, or the next check does
+	lock, err := models.AcquireLock(ctx, announcementCheckLockKey, time.Minute)
+	if err != nil {
+		logs.Error("fail to acquire announcement check lock: %s", err.Error())
+		return
+	}
+	if lock == nil {
+		return
+	}
+	defer lock.Release(ctx)
+
+	pushed, err := as.store.ListPushed(ctx)
+	if err != nil {
+		logs.Error("fail to list pushed announcements: %s", err.Error())
+		return
+	}
+
+	announcements, err := as.store.List(ctx)
+	if err != nil {
+		logs.Error("fail to list announcements: %s", err.Error())
+		return
+	}
+
+	now := time.Now()
+	active := make(map[string]models.Announcement)
+	for _, a := range announcements {
+		if a.IsActive(now) {
+			active[a.ID] = a
+			continue
+		}
+
+		if !a.EndAt.IsZero() && now.Sub(a.EndAt) > announcementRetention {
+			if err := as.store.Delete(ctx, a.ID); err != nil {
+				logs.Error("fail to delete expired announcement %s: %s", a.ID, err.Error())
+			}
+		}
+	}
+
+	// record each push right away, so a failure halfway doesn't push the rest again
+	for id, a := range active {
+		if _, ok := pushed[id]; !ok {
+			as.push(AnnouncementActivated, a)
+			if err := as.store.SetPushed(ctx, a, true); err != nil {
+				logs.Error("fail to record pushed announcement %s: %s", id, err.Error())
+			}
+		}
+	}
+	for id, a := range pushed {
+		if _, ok := active[id]; !ok {
+			as.push(AnnouncementExpired, a)
+			if err := as.store.SetPushed(ctx, a, false); err != nil {
+				logs.Error("fail to record expired announcement %s: %s", id, err.Error())
+			}
+		}
+	}
+}
+
+func (as *AnnouncementService) push(action string, a models.Announcement) {
+	event, err := models.NewEvent(models.EventAnnouncement, map[string]interface{}{
+		"action":       action,
+		"announcement": a,
+	})
+	if err != nil {
+		logs.Error("fail to create announcement event: %s", err.Error())
+		return
+	}
+
+	roomIds := a.RoomIDs
+	if len(roomIds) == 0 {
+		roomIds = append(as.roomService.ListRoomIDs(), models.InternalRoomIDDisplay)
+	}
+
+	for _, roomId := range roomIds {
+		as.eventHubService.Broadcast(roomId, event)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+// AppointmentService books room slots ahead. Check-in at dispenser is done by RoomService, since it creates a queue.
+type AppointmentService struct {
+	bookingLimiter *models.RateLimiter
+
+	// dependencies
+	roomService *RoomService
+}
+
+func NewAppointmentService(roomService *RoomService) *AppointmentService {
+	limit, err := web.AppConfig.Int("appointment::booking_rate_limit")
+	if err != nil || limit < 0 {
+		limit = 5
+	}
+
+	return &AppointmentService{
+		bookingLimiter: models.NewRateLimiter("appointment_booking", limit, time.Minute),
+		roomService:    roomService,
+	}
+}
+
+// AllowBooking counts a booking request of the client IP. If it's over the limit, it returns false and duration to retry after.
+func (as *AppointmentService) AllowBooking(ctx context.Context, ip string) (bool, time.Duration) {
+	isAllowed, retryAfter, err := as.bookingLimiter.Allow(ctx, ip)
+	if err != nil {
+		// rate limit protects booking, it shouldn't make booking unavailable
+		logs.Error("failed to check appointment booking rate limit: %s", err.Error())
+		return true, 0
+	}
+	return isAllowed, retryAfter
+}
+
+func (as *AppointmentService) Book(ctx context.Context, roomId string, info models.QueueInfo, slotAt time.Time) (models.Appointment, error) {
+	room, err := as.roomService.GetRoom(ctx, roomId)
+	if err != nil {
+		return models.Appointment{}, err
+	}
+
+	return room.BookAppointment(ctx, info, slotAt)
+}
+
+// List returns appointments of the room on the business day, by slot
+func (as *AppointmentService) List(ctx context.Context, roomId string, date time.Time) ([]models.Appointment, error) {
+	room, err := as.roomService.GetRoom(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	return room.ListAppointments(ctx, date)
+}
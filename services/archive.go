@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+// only one instance archives at a time in multi node mode
+const archiveLockKey = "archive:lock"
+
+// ArchiveService moves finished days from redis to SQLite archive, so redis only keeps today
+type ArchiveService struct {
+	store *models.ArchiveStore // nil if archive is disabled
+}
+
+func NewArchiveService() *ArchiveService {
+	// archiving deletes redis keys, so it must be enabled explicitly
+	isEnabled, err := web.AppConfig.Bool("archive::enable")
+	if err != nil {
+		isEnabled = false
+	}
+	if !isEnabled {
+		logs.Info("Archive disabled")
+		return &ArchiveService{}
+	}
+
+	path, err := web.AppConfig.String("archive::path")
+	if err != nil || path == "" {
+		path = "data/archive.db"
+	}
+
+	interval, err := web.AppConfig.Int("archive::check_interval")
+	if err != nil || interval <= 0 {
+		interval = 600
+	}
+
+	store, err := models.NewArchiveStore(path)
+	if err != nil {
+		logs.Critical("failed to open archive %s: %s", path, err.Error())
+		panic(err)
+	}
+
+	as := &ArchiveService{
+		store: store,
+	}
+
+	// start archiver, which archives previous days once they're finished
+	go as.run(time.Duration(interval) * time.Second)
+
+	return as
+}
+
+func (as *ArchiveService) IsEnabled() bool {
+	return as.store != nil
+}
+
+func (as *ArchiveService) run(interval time.Duration) {
+	as.archive(context.Background())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		as.archive(context.Background())
+	}
+}
+
+// archive copies each business day before today still in redis to the archive, then deletes it from redis
+func (as *ArchiveService) archive(ctx context.Context) {
+	lock, err := models.AcquireLock(ctx, archiveLockKey, 10*time.Minute)
+	if err != nil {
+		logs.Error("failed to acquire archive lock: %s", err.Error())
+		return
+	}
+	if lock == nil {
+		return
+	}
+	defer lock.Release(ctx)
+
+	dates, err := models.ListRedisDates(ctx, models.BusinessToday())
+	if err != nil {
+		logs.Error("failed to list days to archive: %s", err.Error())
+		return
+	}
+
+	for _, date := range dates {
+		day, keys, err := models.CollectDay(ctx, date)
+		if err != nil {
+			logs.Error("failed to collect %s for archive: %s", date.Format("2006-01-02"), err.Error())
+			continue
+		}
+
+		// keys are only deleted once the day is safely archived
+		if err := as.store.Save(ctx, day); err != nil {
+			logs.Error("failed to archive %s: %s", date.Format("2006-01-02"), err.Error())
+			continue
+		}
+		if err := models.DeleteDayKeys(ctx, keys); err != nil {
+			logs.Error("failed to delete archived keys of %s: %s", date.Format("2006-01-02"), err.Error())
+			continue
+		}
+
+		logs.Info("archived %s: %d tickets, %d keys removed", date.Format("2006-01-02"), len(day.Tickets), len(keys))
+	}
+}
+
+func (as *ArchiveService) IsArchived(ctx context.Context, date time.Time) (bool, error) {
+	if !as.IsEnabled() {
+		return false, nil
+	}
+	return as.store.IsArchived(ctx, date)
+}
+
+func (as *ArchiveService) ListDays(ctx context.Context) ([]models.ArchivedDaySummary, error) {
+	if !as.IsEnabled() {
+		return []models.ArchivedDaySummary{}, nil
+	}
+	return as.store.ListDays(ctx)
+}
+
+func (as *ArchiveService) ListTickets(ctx context.Context, date time.Time) ([]models.ArchivedTicket, error) {
+	if !as.IsEnabled() {
+		return []models.ArchivedTicket{}, nil
+	}
+	return as.store.ListTickets(ctx, date)
+}
+
+// GetTicketJourney returns journey of archived ticket. It returns ErrTicketNotFound if ticket is not in archive.
+func (as *ArchiveService) GetTicketJourney(ctx context.Context, date time.Time, number string) ([]models.TicketJourneyEntry, error) {
+	if !as.IsEnabled() {
+		return nil, ErrTicketNotFound
+	}
+
+	journeys, err := as.store.GetJourneys(ctx, date, number)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, ok := journeys[number]
+	if !ok {
+		return nil, ErrTicketNotFound
+	}
+	for i := 0; i < len(entries)-1; i++ {
+		entries[i].Duration = int(entries[i+1].Timestamp.Sub(entries[i].Timestamp).Seconds())
+	}
+	return entries, nil
+}
+
+// GetDay returns journeys and call logs of an archived day
+func (as *ArchiveService) GetDay(ctx context.Context, date time.Time) (map[string][]models.TicketJourneyEntry, map[string][]models.CallJob, error) {
+	journeys, err := as.store.GetJourneys(ctx, date, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	callLogs, err := as.store.GetCallLogs(ctx, date)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return journeys, callLogs, nil
+}
@@ -16,10 +16,11 @@ type CallService struct {
 	callQueue *models.CallQueue
 
 	// dependencies
-	roomService *RoomService
+	roomService     *RoomService
+	eventHubService *EventHubService
 }
 
-func NewCallService(roomService *RoomService) *CallService {
+func NewCallService(roomService *RoomService, eventHubService *EventHubService) *CallService {
 	callQueue, err := models.NewCallQueue("default")
 	if err != nil {
 		logs.Critical("fail to create call queue: %s", err.Error())
@@ -27,8 +28,9 @@ func NewCallService(roomService *RoomService) *CallService {
 	}
 
 	cs := &CallService{
-		callQueue:   callQueue,
-		roomService: roomService,
+		callQueue:       callQueue,
+		roomService:     roomService,
+		eventHubService: eventHubService,
 	}
 
 	// start consumer
@@ -55,6 +57,44 @@ func (cs *CallService) AddCallJob(ctx context.Context, job models.CallJob) error
 	return cs.callQueue.Addjob(ctx, &job)
 }
 
+// CallNext moves the first queue in main queue to counter, then calls it
+func (cs *CallService) CallNext(ctx context.Context, roomId, counterId string) (string, error) {
+	queueNumber, err := cs.roomService.ProcessNextQueue(ctx, roomId, counterId)
+	if err != nil {
+		return "", err
+	}
+
+	return queueNumber, cs.AddCallJob(ctx, models.CallJob{
+		RoomID:      roomId,
+		CounterID:   counterId,
+		QueueNumber: queueNumber,
+	})
+}
+
+// Recall calls the queue currently served at counter again
+func (cs *CallService) Recall(ctx context.Context, roomId, counterId string) (string, error) {
+	queue, err := cs.roomService.GetCounterQueue(ctx, roomId, counterId)
+	if err != nil {
+		return "", err
+	}
+
+	return queue.Number, cs.AddCallJob(ctx, models.CallJob{
+		RoomID:      roomId,
+		CounterID:   counterId,
+		QueueNumber: queue.Number,
+	})
+}
+
+// CountPendingJobs returns number of call jobs not yet announced
+func (cs *CallService) CountPendingJobs(ctx context.Context) (int64, error) {
+	return cs.callQueue.CountPending(ctx)
+}
+
+// ListCallLogs returns all calls of the room on the date, oldest first
+func (cs *CallService) ListCallLogs(ctx context.Context, roomId string, date time.Time) ([]models.CallJob, error) {
+	return cs.callQueue.ListLogsByDate(ctx, roomId, date, 0)
+}
+
 func (cs *CallService) doCallJob(ctx context.Context, job *models.CallJob) error {
 	// hydrate more details for log
 	// log first so UI can display immediately
@@ -63,7 +103,28 @@ func (cs *CallService) doCallJob(ctx context.Context, job *models.CallJob) error
 		return err
 	}
 
-	// TODO: send visual cue to client UI
+	// send visual cue to client UI, both room and lobby displays
+	event, err := models.NewEvent(models.EventCall, job)
+	if err != nil {
+		return err
+	}
+	cs.eventHubService.Broadcast(job.RoomID, event)
+	cs.eventHubService.Broadcast(models.InternalRoomIDDisplay, event)
+	if !job.EnqueuedAt.IsZero() {
+		callLatencySeconds.WithLabelValues(job.RoomID).Observe(time.Since(job.EnqueuedAt).Seconds())
+	}
+
+	if err := models.NewTicketJourney(job.QueueNumber).Append(ctx, models.TicketJourneyEntry{
+		Action:    models.TicketActionCall,
+		RoomID:    job.RoomID,
+		Queue:     "counter",
+		CounterID: job.CounterID,
+		Actor:     job.CounterID,
+		Timestamp: job.CalledAt,
+	}); err != nil {
+		logs.Error("failed to record journey of %s: %s", job.QueueNumber, err.Error())
+	}
+
 	// TODO: send audio cue to speaker device
 	logs.Debug("call job received with details: ", job)
 
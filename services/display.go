@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+// DisplayService pushes control commands to displays through their event streams
+type DisplayService struct {
+	// dependencies
+	eventHubService *EventHubService
+}
+
+func NewDisplayService(eventHubService *EventHubService) *DisplayService {
+	return &DisplayService{
+		eventHubService: eventHubService,
+	}
+}
+
+// SendRoomCommand sends command to all displays of the room. Command is kept in room history,
+// so displays reconnecting shortly after still receive it.
+func (ds *DisplayService) SendRoomCommand(roomId string, cmd models.DisplayCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+
+	event, err := cmd.Event()
+	if err != nil {
+		return err
+	}
+
+	ds.eventHubService.Broadcast(roomId, event)
+	return nil
+}
+
+// SendClientCommand sends command to all connections of the client
+func (ds *DisplayService) SendClientCommand(clientId string, cmd models.DisplayCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+
+	event, err := cmd.Event()
+	if err != nil {
+		return err
+	}
+
+	n, err := ds.eventHubService.SendToClient(clientId, event)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("client not found")
+	}
+	return nil
+}
@@ -1,111 +1,514 @@
 package services
 
 import (
-	"fmt"
-	"net/http"
+	"context"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
 	"github.com/tommywijayac/duck-queue-server-v2/models"
 )
 
+// clients of other instances, listed by admin, are at most this old
+const clientRegistryInterval = 5 * time.Second
+
+// SlowClientPolicy decides what to do with a client whose buffer is full
+type SlowClientPolicy string
+
+const (
+	// SlowClientDrop drops the message for that client only, client stays connected
+	SlowClientDrop SlowClientPolicy = "drop"
+	// SlowClientDisconnect closes the client, so it reconnects and starts fresh
+	SlowClientDisconnect SlowClientPolicy = "disconnect"
+)
+
+// EventHubService fans out room events to connected clients.
+// Broadcast never blocks on clients: each client has its own buffered queue,
+// drained by its own request goroutine, so a stalled browser only affects itself.
+//
+// In single node mode, events are delivered in-process. Otherwise, events are published
+// through redis and every instance, including the publisher, delivers them to its local clients.
 type EventHubService struct {
-	mu   sync.Mutex
+	bus *models.EventBus // nil in single node mode
+
+	mu   sync.RWMutex
 	hubs map[string]*hub // room id -> hub
+	// room id -> recent events. unlike hub, it's kept after all clients left,
+	// so the last client can still catch up when it reconnects.
+	histories map[string]*history
+
+	bufferSize int
+	replaySize int
+	heartbeat  time.Duration
+	policy     SlowClientPolicy
 }
 
+// hub is set of clients subscribed to a room. It's guarded by EventHubService.mu
 type hub struct {
-	id         string
-	broadcast  chan string
-	register   chan *models.Client
-	unregister chan *models.Client
-	clients    map[*models.Client]struct{}
+	id      string
+	clients map[*models.Client]struct{}
+}
+
+// history is bounded buffer of recent room events. It's guarded by EventHubService.mu
+type history struct {
+	lastID uint64
+	events []models.Event // oldest first, at most replaySize events
 }
 
 func NewEventHubService() *EventHubService {
-	return &EventHubService{
-		hubs: make(map[string]*hub),
+	bufferSize, err := web.AppConfig.Int("event::client_buffer")
+	if err != nil || bufferSize <= 0 {
+		bufferSize = 32
+	}
+
+	replaySize, err := web.AppConfig.Int("event::replay_size")
+	if err != nil || replaySize < 0 {
+		replaySize = 100
+	}
+
+	heartbeat, err := web.AppConfig.Int("event::heartbeat_interval")
+	if err != nil || heartbeat < 0 {
+		heartbeat = 15
+	}
+
+	policy, err := web.AppConfig.String("event::slow_client_policy")
+	if err != nil || (SlowClientPolicy(policy) != SlowClientDrop && SlowClientPolicy(policy) != SlowClientDisconnect) {
+		policy = string(SlowClientDisconnect)
+	}
+
+	eh := &EventHubService{
+		hubs:       make(map[string]*hub),
+		histories:  make(map[string]*history),
+		bufferSize: bufferSize,
+		replaySize: replaySize,
+		heartbeat:  time.Duration(heartbeat) * time.Second,
+		policy:     SlowClientPolicy(policy),
+	}
+
+	isMultiNode, err := web.AppConfig.Bool("event::multi_node")
+	if err == nil && isMultiNode {
+		eh.bus = models.NewEventBus()
+		go eh.relay()
+		go eh.relayClientCommands()
+		go eh.saveClients()
+	}
+
+	return eh
+}
+
+// NewClient creates client writing events through transport. Caller must subscribe it to rooms,
+// run client.WritePump, and call UnsubscribeAll once it returns.
+func (eh *EventHubService) NewClient(info models.ClientInfo, transport models.ClientTransport) *models.Client {
+	if info.ID == "" {
+		info.ID = models.NewClientID()
+	}
+	info.ConnectedAt = time.Now()
+
+	// make room for replayed events, so they don't count toward slow client
+	return models.NewClient(info, transport, eh.bufferSize+eh.replaySize, eh.heartbeat)
+}
+
+// ListLocalClients returns live connections to this instance, per room
+func (eh *EventHubService) ListLocalClients() map[string][]models.ClientInfo {
+	eh.mu.RLock()
+	defer eh.mu.RUnlock()
+
+	clients := make(map[string][]models.ClientInfo, len(eh.hubs))
+	for roomId, h := range eh.hubs {
+		infos := make([]models.ClientInfo, 0, len(h.clients))
+		for client := range h.clients {
+			infos = append(infos, client.Info())
+		}
+		sortClientInfos(infos)
+		clients[roomId] = infos
+	}
+	return clients
+}
+
+// ListClients returns live connections per room. In multi node mode, it includes connections to other instances,
+// as of their last registry refresh.
+func (eh *EventHubService) ListClients() (map[string][]models.ClientInfo, error) {
+	clients := eh.ListLocalClients()
+	if eh.bus == nil {
+		return clients, nil
+	}
+
+	remote, err := eh.bus.ListRemoteClients(context.Background())
+	if err != nil {
+		return nil, err
 	}
+	for roomId, infos := range remote {
+		clients[roomId] = append(clients[roomId], infos...)
+		sortClientInfos(clients[roomId])
+	}
+	return clients, nil
+}
+
+func sortClientInfos(infos []models.ClientInfo) {
+	slices.SortFunc(infos, func(a, b models.ClientInfo) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
 }
 
-func (eh *EventHubService) RegisterClient(roomId, clientId string, writer http.ResponseWriter) {
-	// aggresive locks, who cares
+// countClients returns number of connections with the client id, in any room and any instance
+func (eh *EventHubService) countClients(clientId string) (int, error) {
+	clients, err := eh.ListClients()
+	if err != nil {
+		return 0, err
+	}
+
+	// a connection subscribed to many rooms is listed once per room
+	type connection struct {
+		transport   string
+		ip          string
+		connectedAt int64
+	}
+	connections := make(map[connection]struct{})
+	for _, infos := range clients {
+		for _, info := range infos {
+			if info.ID == clientId {
+				connections[connection{info.Transport, info.IP, info.ConnectedAt.UnixNano()}] = struct{}{}
+			}
+		}
+	}
+	return len(connections), nil
+}
+
+// findClients returns clients with the id, in any room. Must be called with eh.mu held.
+// Client id is given by client, so there may be more than one connection with the same id.
+func (eh *EventHubService) findClients(clientId string) []*models.Client {
+	var clients []*models.Client
+	for _, h := range eh.hubs {
+		for client := range h.clients {
+			if client.ID == clientId && !slices.Contains(clients, client) {
+				clients = append(clients, client)
+			}
+		}
+	}
+	return clients
+}
+
+// DisconnectClient closes all connections of the client. It returns number of closed connections.
+// In multi node mode, the client may be connected to any instance, so the command is relayed to all of them.
+func (eh *EventHubService) DisconnectClient(clientId string) (int, error) {
+	if eh.bus == nil {
+		return eh.disconnectLocal(clientId), nil
+	}
+
+	n, err := eh.countClients(clientId)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	err = eh.bus.PublishClientCommand(context.Background(), models.ClientCommand{
+		ClientID: clientId,
+		Action:   models.ClientCommandDisconnect,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (eh *EventHubService) disconnectLocal(clientId string) int {
+	eh.mu.RLock()
+	clients := eh.findClients(clientId)
+	eh.mu.RUnlock()
+
+	// request goroutine of each client unsubscribes it once WritePump returns
+	for _, client := range clients {
+		client.Close()
+	}
+	return len(clients)
+}
+
+// SendToClient sends event to all connections of the client, without storing it in room history.
+// It returns number of connections the event is sent to.
+// In multi node mode, the client may be connected to any instance, so the event is relayed to all of them.
+func (eh *EventHubService) SendToClient(clientId string, event models.Event) (int, error) {
+	if eh.bus == nil {
+		return eh.sendLocal(clientId, event), nil
+	}
+
+	n, err := eh.countClients(clientId)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	err = eh.bus.PublishClientCommand(context.Background(), models.ClientCommand{
+		ClientID: clientId,
+		Action:   models.ClientCommandSend,
+		Event:    event,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (eh *EventHubService) sendLocal(clientId string, event models.Event) int {
+	eh.mu.RLock()
+	defer eh.mu.RUnlock()
+
+	clients := eh.findClients(clientId)
+	for _, client := range clients {
+		eh.send(client, "", event)
+	}
+	return len(clients)
+}
+
+// Subscribe adds client to the room.
+//
+// If lastEventId is given, i.e. client is reconnecting, events missed since then are replayed before live events.
+// isReplayed is false if missed events are no longer in history, then client isn't subscribed,
+// and caller should send a snapshot instead.
+func (eh *EventHubService) Subscribe(roomId string, client *models.Client, lastEventId string) (isReplayed bool) {
 	eh.mu.Lock()
 	defer eh.mu.Unlock()
 
-	hub, ok := eh.hubs[roomId]
+	replay, isReplayed := eh.getReplay(roomId, lastEventId)
+	if !isReplayed {
+		return false
+	}
+	for _, event := range replay {
+		client.Enqueue(roomId, event)
+	}
+
+	h, ok := eh.hubs[roomId]
 	if !ok {
-		hub = newHub(roomId)
-		go hub.run()
+		h = newHub(roomId)
+		eh.hubs[roomId] = h
 
 		logs.Info("created new room hub ", roomId)
 	}
+	h.clients[client] = struct{}{}
+
+	logs.Info("%s: client %s connected, %d events replayed", roomId, client.ID, len(replay))
+
+	return true
+}
+
+// LastEventID returns id of the last room event delivered by this instance, 0 if there is none yet
+func (eh *EventHubService) LastEventID(roomId string) uint64 {
+	eh.mu.RLock()
+	defer eh.mu.RUnlock()
+
+	hist, ok := eh.histories[roomId]
+	if !ok {
+		return 0
+	}
+	return hist.lastID
+}
+
+// getReplay returns events after lastEventId. Must be called with eh.mu held.
+func (eh *EventHubService) getReplay(roomId, lastEventId string) ([]models.Event, bool) {
+	if lastEventId == "" {
+		return nil, true
+	}
+
+	lastID, err := strconv.ParseUint(lastEventId, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	hist, ok := eh.histories[roomId]
+	if !ok {
+		// no event since server started, client may have seen events from previous run
+		return nil, lastID == 0
+	}
 
-	hub.register <- models.NewClient(clientId, writer)
-	hub.broadcast <- "retry: 5000\n" // set reconnect timing for the session
+	// ids restart from 1 when server restarts
+	if lastID > hist.lastID {
+		return nil, false
+	}
+	if lastID == hist.lastID {
+		return nil, true
+	}
+
+	// gap is too large, some missed events are already evicted
+	if len(hist.events) == 0 || lastID+1 < hist.events[0].ID {
+		return nil, false
+	}
+
+	var replay []models.Event
+	for _, event := range hist.events {
+		if event.ID > lastID {
+			replay = append(replay, event)
+		}
+	}
+	return replay, true
+}
+
+// Unsubscribe removes the client from the room. The hub is removed once no client is left.
+func (eh *EventHubService) Unsubscribe(roomId string, client *models.Client) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
 
-	eh.hubs[roomId] = hub
+	eh.unsubscribe(roomId, client)
 }
 
-func (eh *EventHubService) UnregisterClient(roomId, clientId string) {
-	// aggresive locks, who cares
+// UnsubscribeAll closes the client and removes it from all rooms
+func (eh *EventHubService) UnsubscribeAll(client *models.Client) {
+	client.Close()
+
 	eh.mu.Lock()
 	defer eh.mu.Unlock()
 
-	hub, ok := eh.hubs[roomId]
+	for roomId, h := range eh.hubs {
+		if _, ok := h.clients[client]; ok {
+			eh.unsubscribe(roomId, client)
+		}
+	}
+}
+
+// unsubscribe must be called with eh.mu held
+func (eh *EventHubService) unsubscribe(roomId string, client *models.Client) {
+	h, ok := eh.hubs[roomId]
 	if !ok {
-		logs.Warn("room hub not found ", roomId)
 		return
 	}
 
-	for c := range hub.clients {
-		// don't care whether unregister success or not.
-		// remove the hub asap so it can't be used (h.broadcast<-msg will block in a race condition if wait until hub ACK closed),
-		if len(hub.clients) == 1 {
-			delete(eh.hubs, roomId)
+	delete(h.clients, client)
+	logs.Info("%s: client %s disconnected", roomId, client.ID)
+
+	if len(h.clients) == 0 {
+		delete(eh.hubs, roomId)
+		logs.Info("%s: no client left. hub removed", roomId)
+	}
+}
+
+// Broadcast sends event to all clients connected to the room, on all instances in multi node mode.
+func (eh *EventHubService) Broadcast(roomId string, event models.Event) {
+	if eh.bus == nil {
+		eh.deliver(roomId, event)
+		return
+	}
+
+	if err := eh.bus.Publish(context.Background(), roomId, event); err != nil {
+		// at least local clients get the event. Room event ids are assigned by redis in multi node mode,
+		// so it's sent without id and kept out of history, instead of taking an id other instances may issue.
+		logs.Error("fail to publish room event, delivering locally without replay: %s", err.Error())
+		eh.deliverLocal(roomId, event)
+	}
+}
+
+// relay delivers events published by all instances to local clients
+func (eh *EventHubService) relay() {
+	for event := range eh.bus.Subscribe(context.Background()) {
+		eh.deliver(event.RoomID, event.Event)
+	}
+	logs.Critical("room event subscription stopped")
+}
+
+// relayClientCommands handles client commands published by all instances, including this one
+func (eh *EventHubService) relayClientCommands() {
+	for cmd := range eh.bus.SubscribeClientCommands(context.Background()) {
+		switch cmd.Action {
+		case models.ClientCommandDisconnect:
+			eh.disconnectLocal(cmd.ClientID)
+		case models.ClientCommandSend:
+			eh.sendLocal(cmd.ClientID, cmd.Event)
+		default:
+			logs.Warn("unknown client command %s", cmd.Action)
 		}
+	}
+	logs.Critical("client command subscription stopped")
+}
+
+// saveClients periodically records local clients in registry, so other instances can list them
+func (eh *EventHubService) saveClients() {
+	ticker := time.NewTicker(clientRegistryInterval)
+	defer ticker.Stop()
 
-		if c.Id == clientId {
-			hub.unregister <- c
+	for {
+		// registry outlives a few missed refreshes, and expires once this instance stops
+		err := eh.bus.SaveClients(context.Background(), eh.ListLocalClients(), 3*clientRegistryInterval)
+		if err != nil {
+			logs.Error("failed to save client registry: %s", err.Error())
 		}
+		<-ticker.C
 	}
 }
 
-// hub methods
-func newHub(id string) *hub {
-	return &hub{
-		id:         id,
-		broadcast:  make(chan string),
-		register:   make(chan *models.Client),
-		unregister: make(chan *models.Client),
-		clients:    make(map[*models.Client]struct{}),
+// deliver assigns next room event id to the event if not assigned yet, stores it in room history for replay,
+// then sends it to local clients connected to the room.
+func (eh *EventHubService) deliver(roomId string, event models.Event) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	hist, ok := eh.histories[roomId]
+	if !ok {
+		hist = &history{}
+		eh.histories[roomId] = hist
+	}
+
+	if event.ID == 0 {
+		event.ID = hist.lastID + 1
+	}
+	// events from multiple instances may arrive slightly out of order
+	hist.lastID = max(hist.lastID, event.ID)
+	if eh.replaySize > 0 {
+		if len(hist.events) >= eh.replaySize {
+			hist.events = hist.events[1:]
+		}
+		hist.events = append(hist.events, event)
+	}
+
+	h, ok := eh.hubs[roomId]
+	if !ok {
+		return
+	}
+
+	for client := range h.clients {
+		eh.send(client, roomId, event)
 	}
 }
 
-func (h *hub) run() {
-	for {
-		select {
-		case client := <-h.register:
-			go client.WritePump()
-			h.clients[client] = struct{}{}
+// deliverLocal sends event to local clients connected to the room, without storing it in room history
+func (eh *EventHubService) deliverLocal(roomId string, event models.Event) {
+	eh.mu.RLock()
+	defer eh.mu.RUnlock()
 
-			logs.Info(fmt.Sprintf("%s: client %s connected", h.id, client.Id))
+	event.ID = 0
+	h, ok := eh.hubs[roomId]
+	if !ok {
+		return
+	}
 
-		case client := <-h.unregister:
-			client.Stop <- struct{}{}
-			delete(h.clients, client)
+	for client := range h.clients {
+		eh.send(client, roomId, event)
+	}
+}
 
-			logs.Info(fmt.Sprintf("%s: client %s disconnected", h.id, client.Id))
+// send queues event to client, applying slow client policy if its buffer is full
+func (eh *EventHubService) send(client *models.Client, roomId string, event models.Event) {
+	if client.Enqueue(roomId, event) {
+		return
+	}
 
-			if len(h.clients) == 0 {
-				logs.Info(fmt.Sprintf("%s: no client left. stop running..", h.id))
-				return
-			}
+	select {
+	case <-client.Done():
+		// already closed, waiting to be unregistered
+		return
+	default:
+	}
 
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				client.Send <- message
-			}
-		}
+	switch eh.policy {
+	case SlowClientDrop:
+		logs.Warn("client %s is too slow, message dropped", client.ID)
+	case SlowClientDisconnect:
+		logs.Warn("client %s is too slow, disconnecting", client.ID)
+		client.Close()
+	}
+}
+
+// hub methods
+func newHub(id string) *hub {
+	return &hub{
+		id:      id,
+		clients: make(map[*models.Client]struct{}),
 	}
 }
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+// recordingTransport records events written by WritePump
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []models.RoomEvent
+}
+
+func (t *recordingTransport) WriteEvent(event models.RoomEvent) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, event)
+	return nil
+}
+
+func (t *recordingTransport) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.events)
+}
+
+func (t *recordingTransport) Events() []models.RoomEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]models.RoomEvent(nil), t.events...)
+}
+
+func (t *recordingTransport) WriteHeartbeat() error {
+	return nil
+}
+
+func newTestEventHub(policy SlowClientPolicy, bufferSize, replaySize int) *EventHubService {
+	logs.SetLevel(logs.LevelError)
+
+	return &EventHubService{
+		hubs:       make(map[string]*hub),
+		histories:  make(map[string]*history),
+		bufferSize: bufferSize,
+		replaySize: replaySize,
+		policy:     policy,
+	}
+}
+
+func newTestEvent(t *testing.T, i int) models.Event {
+	t.Helper()
+
+	event, err := models.NewEvent(models.EventCall, map[string]int{"i": i})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// assertIncreasing fails if event ids are not strictly increasing per room. Events without id,
+// e.g. sent to a single client, are not part of room history so they're skipped.
+func assertIncreasing(t *testing.T, name string, events []models.RoomEvent) {
+	t.Helper()
+
+	lastIDs := make(map[string]uint64)
+	for _, event := range events {
+		if event.ID == 0 {
+			continue
+		}
+		if event.ID <= lastIDs[event.RoomID] {
+			t.Errorf("%s: room %s event id %d after %d", name, event.RoomID, event.ID, lastIDs[event.RoomID])
+		}
+		lastIDs[event.RoomID] = event.ID
+	}
+}
+
+func TestEventHubConcurrentSubscribeBroadcast(t *testing.T) {
+	const (
+		subscribers    = 20
+		reconnects     = 10
+		broadcasters   = 5
+		perBroadcaster = 200
+	)
+	rooms := []string{"A", "B", "C"}
+
+	// drop policy keeps clients connected, so they see as many events as possible
+	eh := newTestEventHub(SlowClientDrop, 8, 16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < subscribers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for r := 0; r < reconnects; r++ {
+				transport := &recordingTransport{}
+				client := eh.NewClient(models.ClientInfo{ID: fmt.Sprintf("client-%d", i)}, transport)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				pumpDone := make(chan struct{})
+				go func() {
+					defer close(pumpDone)
+					client.WritePump(ctx)
+				}()
+
+				for _, roomId := range rooms {
+					eh.Subscribe(roomId, client, "")
+				}
+				time.Sleep(time.Millisecond)
+				if r%2 == 0 {
+					eh.Unsubscribe(rooms[0], client)
+				}
+				eh.UnsubscribeAll(client)
+
+				cancel()
+				<-pumpDone
+				assertIncreasing(t, client.ID, transport.Events())
+			}
+		}(i)
+	}
+
+	for i := 0; i < broadcasters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < perBroadcaster; j++ {
+				eh.Broadcast(rooms[j%len(rooms)], newTestEvent(t, i*perBroadcaster+j))
+			}
+		}(i)
+	}
+
+	// admin actions run concurrently with connections too
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for j := 0; j < 100; j++ {
+			eh.ListClients()
+			eh.SendToClient("client-0", newTestEvent(t, j))
+			eh.DisconnectClient("client-1")
+		}
+	}()
+
+	wg.Wait()
+
+	if len(eh.ListLocalClients()) != 0 {
+		t.Errorf("expected all hubs removed, got %v", eh.ListLocalClients())
+	}
+
+	total := uint64(broadcasters * perBroadcaster)
+	var delivered uint64
+	for _, roomId := range rooms {
+		hist := eh.histories[roomId]
+		delivered += hist.lastID
+
+		if len(hist.events) != eh.replaySize {
+			t.Errorf("room %s: expected %d events in history, got %d", roomId, eh.replaySize, len(hist.events))
+		}
+		for k := 1; k < len(hist.events); k++ {
+			if hist.events[k].ID != hist.events[k-1].ID+1 {
+				t.Errorf("room %s: history id %d after %d", roomId, hist.events[k].ID, hist.events[k-1].ID)
+			}
+		}
+	}
+	if delivered != total {
+		t.Errorf("expected %d events assigned ids, got %d", total, delivered)
+	}
+}
+
+func TestEventHubSlowClientDisconnect(t *testing.T) {
+	eh := newTestEventHub(SlowClientDisconnect, 2, 0)
+
+	// WritePump is not running, so nothing drains the buffer
+	client := eh.NewClient(models.ClientInfo{ID: "slow"}, &recordingTransport{})
+	eh.Subscribe("A", client, "")
+
+	for i := 0; i < 3; i++ {
+		eh.Broadcast("A", newTestEvent(t, i))
+	}
+
+	select {
+	case <-client.Done():
+	default:
+		t.Fatal("expected slow client to be disconnected")
+	}
+
+	// broadcasting to a closed client which isn't unsubscribed yet must not panic
+	eh.Broadcast("A", newTestEvent(t, 3))
+	eh.UnsubscribeAll(client)
+	eh.Broadcast("A", newTestEvent(t, 4))
+}
+
+func TestEventHubSlowClientDrop(t *testing.T) {
+	eh := newTestEventHub(SlowClientDrop, 2, 0)
+
+	// WritePump is not running yet, so only the first events fit the buffer
+	transport := &recordingTransport{}
+	client := eh.NewClient(models.ClientInfo{ID: "slow"}, transport)
+	eh.Subscribe("A", client, "")
+
+	for i := 0; i < 5; i++ {
+		eh.Broadcast("A", newTestEvent(t, i))
+	}
+
+	select {
+	case <-client.Done():
+		t.Fatal("expected slow client to stay connected")
+	default:
+	}
+
+	events := collect(t, client, transport, 2)
+	eh.UnsubscribeAll(client)
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.ID != uint64(i+1) {
+			t.Errorf("expected event id %d, got %d", i+1, event.ID)
+		}
+	}
+}
+
+func TestEventHubReplay(t *testing.T) {
+	eh := newTestEventHub(SlowClientDisconnect, 8, 3)
+
+	for i := 0; i < 5; i++ {
+		eh.Broadcast("A", newTestEvent(t, i))
+	}
+
+	tests := []struct {
+		lastEventId    string
+		wantIsReplayed bool
+		wantIDs        []uint64
+	}{
+		{lastEventId: "", wantIsReplayed: true},
+		{lastEventId: "5", wantIsReplayed: true},
+		{lastEventId: "3", wantIsReplayed: true, wantIDs: []uint64{4, 5}},
+		{lastEventId: "2", wantIsReplayed: true, wantIDs: []uint64{3, 4, 5}},
+		// event 2 is already evicted
+		{lastEventId: "1", wantIsReplayed: false},
+		// ids from previous run of the server
+		{lastEventId: "9", wantIsReplayed: false},
+		{lastEventId: "invalid", wantIsReplayed: false},
+	}
+
+	for _, tt := range tests {
+		transport := &recordingTransport{}
+		client := eh.NewClient(models.ClientInfo{ID: "replay"}, transport)
+
+		isReplayed := eh.Subscribe("A", client, tt.lastEventId)
+		// client is left to be subscribed after its snapshot
+		isSubscribed := len(eh.ListLocalClients()["A"]) == 1
+		events := collect(t, client, transport, len(tt.wantIDs))
+		eh.UnsubscribeAll(client)
+
+		if isReplayed != tt.wantIsReplayed {
+			t.Errorf("last event id %q: expected replayed %v, got %v", tt.lastEventId, tt.wantIsReplayed, isReplayed)
+		}
+		if isSubscribed != tt.wantIsReplayed {
+			t.Errorf("last event id %q: expected subscribed %v, got %v", tt.lastEventId, tt.wantIsReplayed, isSubscribed)
+		}
+
+		var ids []uint64
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+			t.Errorf("last event id %q: expected replay %v, got %v", tt.lastEventId, tt.wantIDs, ids)
+		}
+	}
+
+	// new events continue after replayed ones
+	eh.Broadcast("A", newTestEvent(t, 5))
+	if got := eh.histories["A"].lastID; got != 6 {
+		t.Errorf("expected last id 6, got %d", got)
+	}
+}
+
+// collect runs WritePump until want events are written or timeout, then returns written events
+func collect(t *testing.T, client *models.Client, transport *recordingTransport, want int) []models.RoomEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pumpDone := make(chan struct{})
+	go func() {
+		defer close(pumpDone)
+		client.WritePump(ctx)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for transport.Len() < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-pumpDone
+
+	return transport.Events()
+}
+
+func TestEventHubDeliverLocalSkipsHistory(t *testing.T) {
+	eh := newTestEventHub(SlowClientDisconnect, 8, 3)
+	eh.Broadcast("A", newTestEvent(t, 0))
+
+	transport := &recordingTransport{}
+	client := eh.NewClient(models.ClientInfo{ID: "local"}, transport)
+	eh.Subscribe("A", client, "")
+
+	// fallback delivery when publishing to other instances fails
+	eh.deliverLocal("A", newTestEvent(t, 1))
+	events := collect(t, client, transport, 1)
+	eh.UnsubscribeAll(client)
+
+	if len(events) != 1 || events[0].ID != 0 {
+		t.Fatalf("expected 1 event without id, got %v", events)
+	}
+	if hist := eh.histories["A"]; hist.lastID != 1 || len(hist.events) != 1 {
+		t.Errorf("expected history untouched, got last id %d and %d events", hist.lastID, len(hist.events))
+	}
+}
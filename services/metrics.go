@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// event metrics, incremented by services where the event happens
+var (
+	ticketsCreatedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "duck_tickets_created_total",
+		Help: "Tickets created, by room.",
+	}, []string{"room"})
+
+	ticketsMovedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "duck_tickets_moved_total",
+		Help: "Tickets moved to other room, by source and destination room.",
+	}, []string{"from_room", "to_room"})
+
+	ticketsSkippedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "duck_tickets_skipped_total",
+		Help: "Tickets skipped, by room and counter.",
+	}, []string{"room", "counter"})
+
+	callLatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "duck_call_latency_seconds",
+		Help:    "Time from call job enqueued until it's announced, by room.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"room"})
+
+	ticketsPrintedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "duck_tickets_printed_total",
+		Help: "Ticket print attempts, by printer and result (success, failure).",
+	}, []string{"printer", "result"})
+)
+
+// MetricsService exposes event metrics, and state gauges collected from other services on scrape
+type MetricsService struct {
+	queueLength     *prometheus.Desc
+	eventClients    *prometheus.Desc
+	callJobsPending *prometheus.Desc
+
+	// dependencies
+	roomService     *RoomService
+	eventHubService *EventHubService
+	callService     *CallService
+}
+
+func NewMetricsService(roomService *RoomService, eventHubService *EventHubService, callService *CallService) *MetricsService {
+	ms := &MetricsService{
+		queueLength: prometheus.NewDesc("duck_queue_length",
+			"Tickets in queue, by room and queue (main, skip, counter:{id}).",
+			[]string{"room", "queue"}, nil),
+		eventClients: prometheus.NewDesc("duck_event_clients",
+			"Connected event stream clients, by room hub and transport.",
+			[]string{"room", "transport"}, nil),
+		callJobsPending: prometheus.NewDesc("duck_call_jobs_pending",
+			"Call jobs not yet announced, either waiting in stream or being processed.",
+			nil, nil),
+		roomService:     roomService,
+		eventHubService: eventHubService,
+		callService:     callService,
+	}
+
+	prometheus.MustRegister(ms)
+
+	return ms
+}
+
+// Handler serves all registered metrics in prometheus format
+func (ms *MetricsService) Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func (ms *MetricsService) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ms.queueLength
+	ch <- ms.eventClients
+	ch <- ms.callJobsPending
+}
+
+func (ms *MetricsService) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, roomId := range ms.roomService.ListRoomIDs() {
+		room, err := ms.roomService.GetRoom(ctx, roomId)
+		if err != nil {
+			continue
+		}
+
+		lengths, err := room.GetQueueLengths(ctx)
+		if err != nil {
+			logs.Error("failed to collect queue length of room %s: %s", roomId, err.Error())
+			continue
+		}
+		for queue, length := range lengths {
+			ch <- prometheus.MustNewConstMetric(ms.queueLength, prometheus.GaugeValue, float64(length), roomId, queue)
+		}
+	}
+
+	// per instance, like the rest of process metrics
+	for roomId, clients := range ms.eventHubService.ListLocalClients() {
+		counts := make(map[string]int)
+		for _, client := range clients {
+			counts[string(client.Transport)]++
+		}
+		for transport, count := range counts {
+			ch <- prometheus.MustNewConstMetric(ms.eventClients, prometheus.GaugeValue, float64(count), roomId, transport)
+		}
+	}
+
+	pending, err := ms.callService.CountPendingJobs(ctx)
+	if err != nil {
+		logs.Error("failed to collect pending call jobs: %s", err.Error())
+	} else {
+		ch <- prometheus.MustNewConstMetric(ms.callJobsPending, prometheus.GaugeValue, float64(pending))
+	}
+}
@@ -1,8 +1,15 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
 	"github.com/tommywijayac/duck-queue-server-v2/models"
 )
@@ -11,9 +18,32 @@ type PrinterService struct {
 	LogoPath string
 	Title    string
 	Subtitle string
+
+	// TicketURL is ticket status page URL, with %s replaced by queue number.
+	// If set, the URL is printed as QR code so patients can track their position.
+	TicketURL string
+	// IsBarcode prints queue number as barcode so staff can scan the ticket at the counter.
+	IsBarcode bool
+
+	// IsBlockWhenDown rejects ticket creation when printer is known to be down,
+	// so patients don't get a number in the system without the physical ticket.
+	IsBlockWhenDown bool
+
+	printers map[string]models.PrinterConfig // printer id -> config
+	fonts    models.PrinterFonts
+	// routing: dispenser client id / source room id -> printer id
+	clientPrinters map[string]string
+	roomPrinters   map[string]string
+
+	mu             sync.RWMutex
+	statuses       map[string]models.PrinterStatus // printer id -> last known status
+	dispenserRooms []string                        // rooms notified on default printer status change
+
+	// dependencies
+	eventHubService *EventHubService
 }
 
-func NewPrinterService() *PrinterService {
+func NewPrinterService(eventHubService *EventHubService) *PrinterService {
 	logo, err := web.AppConfig.String("printer::logo")
 	if err != nil {
 		logo = ""
@@ -26,15 +56,245 @@ func NewPrinterService() *PrinterService {
 	if err != nil {
 		subtitle = ""
 	}
+	ticketURL, err := web.AppConfig.String("printer::ticket_url")
+	if err != nil {
+		ticketURL = ""
+	}
+	isBarcode, err := web.AppConfig.Bool("printer::barcode")
+	if err != nil {
+		isBarcode = false
+	}
 
-	return &PrinterService{
-		LogoPath: logo,
-		Title:    title,
-		Subtitle: subtitle,
+	isBlockWhenDown, err := web.AppConfig.Bool("printer::block_when_down")
+	if err != nil {
+		isBlockWhenDown = false
 	}
+	interval, err := web.AppConfig.Int("printer::status_interval")
+	if err != nil || interval <= 0 {
+		interval = 10
+	}
+
+	printers, err := loadPrinters()
+	if err != nil {
+		logs.Critical("failed to create printer service: failed to load printers: %s", err.Error())
+		panic(err)
+	}
+
+	fonts, err := models.LoadPrinterFonts()
+	if err != nil {
+		logs.Critical("failed to create printer service: failed to load fonts: %s", err.Error())
+		panic(err)
+	}
+
+	clientPrinters := make(map[string]string)
+	roomPrinters := make(map[string]string)
+	statuses := make(map[string]models.PrinterStatus)
+	for printerId, cfg := range printers {
+		for _, clientId := range cfg.ClientIDs {
+			clientPrinters[clientId] = printerId
+		}
+		for _, roomId := range cfg.RoomIDs {
+			roomPrinters[roomId] = printerId
+		}
+		statuses[printerId] = models.PrinterStatus{State: models.PrinterStateUnknown}
+	}
+
+	ps := &PrinterService{
+		LogoPath:        logo,
+		Title:           title,
+		Subtitle:        subtitle,
+		TicketURL:       ticketURL,
+		IsBarcode:       isBarcode,
+		IsBlockWhenDown: isBlockWhenDown,
+		printers:        printers,
+		fonts:           fonts,
+		clientPrinters:  clientPrinters,
+		roomPrinters:    roomPrinters,
+		statuses:        statuses,
+		eventHubService: eventHubService,
+	}
+
+	// start status monitor
+	go ps.monitor(time.Duration(interval) * time.Second)
+
+	return ps
 }
 
-func (ps *PrinterService) PrintQueue(queueNumber string) error {
+// loadPrinters reads named printers from printers file. If not configured,
+// the [printer] section is used as the only printer, which serves all dispensers.
+func loadPrinters() (map[string]models.PrinterConfig, error) {
+	configFile, err := web.AppConfig.String("printer::printers")
+	if err != nil || configFile == "" {
+		return map[string]models.PrinterConfig{
+			defaultPrinterID: models.DefaultPrinterConfig(),
+		}, nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var printers map[string]models.PrinterConfig
+	if err := json.Unmarshal(data, &printers); err != nil {
+		return nil, err
+	}
+	if len(printers) == 0 {
+		return nil, errors.New("no printer configured")
+	}
+
+	return printers, nil
+}
+
+const defaultPrinterID = "default"
+
+// SetDispenserRooms sets rooms whose clients are notified when status of a printer without room routing changes
+func (ps *PrinterService) SetDispenserRooms(roomIds []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.dispenserRooms = roomIds
+}
+
+// resolvePrinter finds printer next to the dispenser. Dispenser client id is matched first,
+// then the source room. Fallback to default printer, or any printer if there is only one.
+func (ps *PrinterService) resolvePrinter(sourceRoomId, clientId string) (string, error) {
+	if printerId, ok := ps.clientPrinters[clientId]; ok && clientId != "" {
+		return printerId, nil
+	}
+	if printerId, ok := ps.roomPrinters[sourceRoomId]; ok {
+		return printerId, nil
+	}
+	if _, ok := ps.printers[defaultPrinterID]; ok {
+		return defaultPrinterID, nil
+	}
+	if len(ps.printers) == 1 {
+		for printerId := range ps.printers {
+			return printerId, nil
+		}
+	}
+	return "", fmt.Errorf("no printer configured for room %s", sourceRoomId)
+}
+
+func (ps *PrinterService) GetStatuses() map[string]models.PrinterStatus {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	statuses := make(map[string]models.PrinterStatus, len(ps.statuses))
+	for printerId, status := range ps.statuses {
+		statuses[printerId] = status
+	}
+	return statuses
+}
+
+// GetStatus returns status of the printer serving the dispenser
+func (ps *PrinterService) GetStatus(sourceRoomId, clientId string) (models.PrinterStatus, error) {
+	printerId, err := ps.resolvePrinter(sourceRoomId, clientId)
+	if err != nil {
+		return models.PrinterStatus{}, err
+	}
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	return ps.statuses[printerId], nil
+}
+
+// IsBlocked reports whether ticket creation should be rejected due to printer status.
+// It returns error if no printer serves the dispenser, since the ticket couldn't be printed at all.
+func (ps *PrinterService) IsBlocked(sourceRoomId, clientId string) (bool, error) {
+	status, err := ps.GetStatus(sourceRoomId, clientId)
+	if err != nil {
+		return false, err
+	}
+
+	if !ps.IsBlockWhenDown {
+		return false, nil
+	}
+	return status.IsDown(), nil
+}
+
+func (ps *PrinterService) monitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for printerId, cfg := range ps.printers {
+			ps.checkStatus(printerId, cfg)
+		}
+
+		<-ticker.C
+	}
+}
+
+func (ps *PrinterService) checkStatus(printerId string, cfg models.PrinterConfig) {
+	status := models.NewPrinterBuilder().Build(cfg, ps.fonts).Status()
+
+	ps.mu.Lock()
+	isChanged := ps.statuses[printerId].State != status.State
+	ps.statuses[printerId] = status
+	rooms := cfg.RoomIDs
+	if len(rooms) == 0 {
+		rooms = ps.dispenserRooms
+	}
+	ps.mu.Unlock()
+
+	if !isChanged {
+		return
+	}
+
+	logs.Info("printer %s status changed to %s %s", printerId, status.State, status.Message)
+
+	event, err := models.NewEvent(models.EventPrinterStatus, map[string]interface{}{
+		"printer_id": printerId,
+		"status":     status,
+	})
+	if err != nil {
+		logs.Error("fail to create printer status event: %s", err.Error())
+		return
+	}
+
+	for _, roomId := range rooms {
+		ps.eventHubService.Broadcast(roomId, event)
+	}
+}
+
+const (
+	PreviewFormatPDF = "pdf"
+	PreviewFormatPNG = "png"
+)
+
+// PrintQueue prints ticket at the printer next to the dispenser
+// estimatedWait is printed only if it's known, i.e. non zero
+func (ps *PrinterService) PrintQueue(sourceRoomId, clientId, queueNumber string, estimatedWait time.Duration) error {
+	printerId, err := ps.resolvePrinter(sourceRoomId, clientId)
+	if err != nil {
+		return err
+	}
+
+	if err := ps.buildTicket(queueNumber, estimatedWait).Build(ps.printers[printerId], ps.fonts).Print(); err != nil {
+		ticketsPrintedTotal.WithLabelValues(printerId, "failure").Inc()
+		return err
+	}
+
+	ticketsPrintedTotal.WithLabelValues(printerId, "success").Inc()
+	return nil
+}
+
+// PreviewQueue renders ticket with the same layout as PrintQueue, without sending it to printer.
+func (ps *PrinterService) PreviewQueue(w io.Writer, queueNumber, format string) error {
+	printer := ps.buildTicket(queueNumber, 0).Build(models.PrinterConfig{}, ps.fonts)
+
+	switch format {
+	case PreviewFormatPDF:
+		return printer.WritePDF(w)
+	case PreviewFormatPNG:
+		return printer.WritePNG(w)
+	}
+	return errors.New("invalid preview format")
+}
+
+func (ps *PrinterService) buildTicket(queueNumber string, estimatedWait time.Duration) *models.PrinterBuilder {
 	builder := models.NewPrinterBuilder()
 
 	if len(ps.LogoPath) > 0 {
@@ -51,8 +311,8 @@ func (ps *PrinterService) PrintQueue(queueNumber string) error {
 		builder.AddText(ps.Subtitle).AddSpace(1.5)
 	}
 
-	printer := builder.
-		AddText(time.Now().Format("2 Jan 2006, 15:04:05"),
+	builder.
+		AddText(time.Now().In(models.BusinessLocation()).Format("2 Jan 2006, 15:04:05"),
 			models.WithPrinterLineSize(models.FontSize{Point: 8}),
 		).
 		AddSpace(1.5).
@@ -63,9 +323,28 @@ func (ps *PrinterService) PrintQueue(queueNumber string) error {
 			models.WithPrinterLineStyle(models.FontStyle{Bold: true, Underline: true})).
 		AddSpace(2).
 		AddText("please wait to be called").
-		AddSpace(1).
-		AddText("---").
-		Build()
+		AddSpace(1)
+
+	if estimatedWait > 0 {
+		// round up, so a short wait is not printed as 0 min
+		minutes := int((estimatedWait + time.Minute - 1) / time.Minute)
+		builder.AddText(fmt.Sprintf("estimated wait: ~%d min", minutes),
+			models.WithPrinterLineSize(models.FontSize{Point: 8}),
+		).AddSpace(1)
+	}
+
+	if ps.IsBarcode {
+		builder.AddBarcode(queueNumber).AddSpace(1)
+	}
+
+	if len(ps.TicketURL) > 0 {
+		builder.AddQRCode(fmt.Sprintf(ps.TicketURL, queueNumber)).
+			AddText("scan to check your queue",
+				models.WithPrinterLineSize(models.FontSize{Point: 8}),
+			).
+			AddSpace(1)
+	}
 
-	return printer.Print()
+	return builder.
+		AddText("---")
 }
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+// ReportService builds operational reports from ticket journeys and call logs
+type ReportService struct {
+	// dependencies
+	roomService    *RoomService
+	callService    *CallService
+	archiveService *ArchiveService
+}
+
+func NewReportService(roomService *RoomService, callService *CallService, archiveService *ArchiveService) *ReportService {
+	return &ReportService{
+		roomService:    roomService,
+		callService:    callService,
+		archiveService: archiveService,
+	}
+}
+
+// GetDailyReport aggregates throughput and timing of the date, per room and counter
+func (rps *ReportService) GetDailyReport(ctx context.Context, date time.Time) (models.DailyReport, error) {
+	rooms := make(map[string]models.RoomDetail)
+	for _, roomId := range rps.roomService.ListRoomIDs() {
+		detail, _, err := rps.roomService.GetRoomDetails(ctx, roomId)
+		if err != nil {
+			return models.DailyReport{}, err
+		}
+		rooms[roomId] = detail
+	}
+
+	builder := models.NewDailyReportBuilder(date, rooms)
+
+	// finished days are moved from redis to archive
+	isArchived, err := rps.archiveService.IsArchived(ctx, date)
+	if err != nil {
+		return models.DailyReport{}, err
+	}
+	if isArchived {
+		journeys, callLogs, err := rps.archiveService.GetDay(ctx, date)
+		if err != nil {
+			return models.DailyReport{}, err
+		}
+		for _, entries := range journeys {
+			builder.AddJourney(entries)
+		}
+		for roomId, jobs := range callLogs {
+			builder.AddCallLogs(roomId, jobs)
+		}
+		return builder.Build(), nil
+	}
+
+	journeys, err := models.ListTicketJourneysByDate(ctx, date)
+	if err != nil {
+		return models.DailyReport{}, err
+	}
+	for _, entries := range journeys {
+		builder.AddJourney(entries)
+	}
+
+	for roomId := range rooms {
+		jobs, err := rps.callService.ListCallLogs(ctx, roomId, date)
+		if err != nil {
+			return models.DailyReport{}, err
+		}
+		builder.AddCallLogs(roomId, jobs)
+	}
+
+	return builder.Build(), nil
+}
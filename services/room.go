@@ -1,12 +1,17 @@
 package services
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
@@ -16,11 +21,16 @@ import (
 type RoomService struct {
 	rooms map[string]*models.Room
 
+	// last broadcasted wait estimate per room, so clients are only notified when it changes
+	estimatesMu sync.Mutex
+	estimates   map[string]models.WaitEstimate
+
 	// dependencies
-	printerService *PrinterService
+	printerService  *PrinterService
+	eventHubService *EventHubService
 }
 
-func NewRoomService(printerService *PrinterService) *RoomService {
+func NewRoomService(printerService *PrinterService, eventHubService *EventHubService) *RoomService {
 	rooms, err := loadRooms()
 	if err != nil {
 		logs.Critical("failed to create room service: failed to load rooms: %s", err.Error())
@@ -28,9 +38,23 @@ func NewRoomService(printerService *PrinterService) *RoomService {
 	}
 	logs.Info("Room configuration loaded successfully")
 
+	// dispensers are rooms which create queue
+	var dispenserRooms []string
+	for _, room := range rooms {
+		for _, a := range room.Actions {
+			if a.Action == models.RoomActionCreate {
+				dispenserRooms = append(dispenserRooms, room.Id)
+				break
+			}
+		}
+	}
+	printerService.SetDispenserRooms(dispenserRooms)
+
 	return &RoomService{
-		rooms:          rooms,
-		printerService: printerService,
+		rooms:           rooms,
+		estimates:       make(map[string]models.WaitEstimate),
+		printerService:  printerService,
+		eventHubService: eventHubService,
 	}
 }
 
@@ -55,13 +79,56 @@ func loadRooms() (map[string]*models.Room, error) {
 	// load
 	rooms := make(map[string]*models.Room)
 	for roomId, rdetail := range cfg {
-		rooms[roomId] = models.NewRoom(roomId, rdetail)
+		room, err := models.NewRoom(roomId, rdetail)
+		if err != nil {
+			return nil, err
+		}
+		rooms[roomId] = room
+	}
+
+	if err := validatePrefixes(rooms); err != nil {
+		return nil, err
 	}
 
 	return rooms, nil
 }
 
-func (rs *RoomService) CreateQueue(ctx context.Context, sourceRoomId, destRoomId string, info models.QueueInfo) (models.QueueItem, error) {
+// validatePrefixes makes sure a queue number belongs to one room only. Since numbers are prefix followed by digits,
+// a prefix that starts another room's prefix is ambiguous too, e.g. "A" and "AB" both match "AB001".
+func validatePrefixes(rooms map[string]*models.Room) error {
+	type roomPrefix struct {
+		roomId string
+		prefix string
+	}
+
+	var prefixes []roomPrefix
+	for roomId, room := range rooms {
+		for _, prefix := range room.Numbering.Prefixes() {
+			prefixes = append(prefixes, roomPrefix{roomId: roomId, prefix: prefix})
+		}
+	}
+	// sort so the same config always reports the same collision
+	slices.SortFunc(prefixes, func(a, b roomPrefix) int {
+		return cmp.Or(strings.Compare(a.prefix, b.prefix), strings.Compare(a.roomId, b.roomId))
+	})
+
+	for i, p := range prefixes {
+		for _, other := range prefixes[i+1:] {
+			if other.roomId == p.roomId || !strings.HasPrefix(other.prefix, p.prefix) {
+				continue
+			}
+			if other.prefix == p.prefix {
+				return fmt.Errorf("rooms %s and %s use the same queue number prefix %q", p.roomId, other.roomId, p.prefix)
+			}
+			return fmt.Errorf("queue number prefix %q of room %s is a prefix of %q of room %s",
+				p.prefix, p.roomId, other.prefix, other.roomId)
+		}
+	}
+
+	return nil
+}
+
+func (rs *RoomService) CreateQueue(ctx context.Context, sourceRoomId, destRoomId, clientId string, info models.QueueInfo) (models.QueueItem, error) {
 	sourceRoom, exists := rs.rooms[sourceRoomId]
 	if !exists {
 		return models.QueueItem{}, errors.New("source room not found")
@@ -75,18 +142,97 @@ func (rs *RoomService) CreateQueue(ctx context.Context, sourceRoomId, destRoomId
 		return models.QueueItem{}, fmt.Errorf("'create' action %s to %s is not allowed", sourceRoom.Id, destRoom.Id)
 	}
 
+	// check before creating, so ticket isn't created when it can't be printed
+	isBlocked, err := rs.printerService.IsBlocked(sourceRoomId, clientId)
+	if err != nil {
+		return models.QueueItem{}, err
+	}
+	if isBlocked {
+		return models.QueueItem{}, errors.New("printer is not ready")
+	}
+
+	// estimate before creating, new ticket is placed after all waiting tickets
+	estimate, err := destRoom.GetWaitEstimate(ctx)
+	if err != nil {
+		logs.Error("failed to estimate wait of room %s: %s", destRoomId, err.Error())
+	}
+
 	queue, err := destRoom.CreateQueue(ctx, info)
 	if err != nil {
 		return models.QueueItem{}, err
 	}
+	queue.EstimatedWait = estimate.WaitSeconds
 
-	// if failed to print, then user would not get their physical queue number
-	// return error even though queue is already created in system
-	if err := rs.printerService.PrintQueue(queue.Number); err != nil {
+	if err := rs.issueQueue(ctx, sourceRoomId, destRoomId, clientId, queue); err != nil {
 		return models.QueueItem{}, err
 	}
+	return queue, nil
+}
+
+// CheckInAppointment creates a queue for the booking code at dispenser, in the room the appointment is booked for
+func (rs *RoomService) CheckInAppointment(ctx context.Context, sourceRoomId, clientId, code string) (models.QueueItem, models.Appointment, error) {
+	appointment, err := models.GetAppointment(ctx, code)
+	if err != nil {
+		return models.QueueItem{}, models.Appointment{}, err
+	}
 
-	return queue, err
+	sourceRoom, exists := rs.rooms[sourceRoomId]
+	if !exists {
+		return models.QueueItem{}, models.Appointment{}, errors.New("source room not found")
+	}
+	destRoom, exists := rs.rooms[appointment.RoomID]
+	if !exists {
+		return models.QueueItem{}, models.Appointment{}, errors.New("appointment room not found")
+	}
+
+	if !isActionAllowed(models.RoomActionCreate, sourceRoom, destRoom) {
+		return models.QueueItem{}, models.Appointment{}, fmt.Errorf("'create' action %s to %s is not allowed", sourceRoom.Id, destRoom.Id)
+	}
+
+	// check before creating, so ticket isn't created when it can't be printed
+	isBlocked, err := rs.printerService.IsBlocked(sourceRoomId, clientId)
+	if err != nil {
+		return models.QueueItem{}, models.Appointment{}, err
+	}
+	if isBlocked {
+		return models.QueueItem{}, models.Appointment{}, errors.New("printer is not ready")
+	}
+
+	queue, appointment, err := destRoom.CheckInAppointment(ctx, appointment)
+	if err != nil {
+		return models.QueueItem{}, models.Appointment{}, err
+	}
+
+	// on time appointment doesn't wait behind walk-ins, so estimate from its position instead
+	ticket, isFound, err := destRoom.FindTicket(ctx, queue.Number)
+	if err != nil {
+		logs.Error("failed to estimate wait of %s: %s", queue.Number, err.Error())
+	} else if isFound {
+		queue.EstimatedWait = ticket.EstimatedWait
+	}
+
+	if err := rs.issueQueue(ctx, sourceRoomId, destRoom.Id, clientId, queue); err != nil {
+		return models.QueueItem{}, models.Appointment{}, err
+	}
+	return queue, appointment, nil
+}
+
+// issueQueue records and prints a queue just created in destination room
+func (rs *RoomService) issueQueue(ctx context.Context, sourceRoomId, destRoomId, clientId string, queue models.QueueItem) error {
+	ticketsCreatedTotal.WithLabelValues(destRoomId).Inc()
+	rs.appendJourney(ctx, queue.Number, models.TicketJourneyEntry{
+		Action: models.TicketActionCreate,
+		RoomID: destRoomId,
+		Queue:  "main",
+		Actor:  clientId,
+		Info:   &queue.QueueInfo,
+	})
+	rs.broadcastWaitEstimate(ctx, destRoomId)
+
+	// if failed to print, then user would not get their physical queue number
+	// return error even though queue is already created in system
+	estimatedWait := time.Duration(queue.EstimatedWait) * time.Second
+	return rs.printerService.PrintQueue(sourceRoomId, clientId, queue.Number, estimatedWait)
 }
 
 func (rs *RoomService) ProcessQueue(ctx context.Context, roomId, originQueue, counterId, queueNumber string) error {
@@ -100,7 +246,61 @@ func (rs *RoomService) ProcessQueue(ctx context.Context, roomId, originQueue, co
 		return errors.New("counter not found in room")
 	}
 
-	return room.ProcessQueue(ctx, originQueue, counterId, queueNumber)
+	if err := room.ProcessQueue(ctx, originQueue, counterId, queueNumber); err != nil {
+		return err
+	}
+
+	rs.appendJourney(ctx, queueNumber, models.TicketJourneyEntry{
+		Action:    models.TicketActionProcess,
+		RoomID:    roomId,
+		Queue:     "counter",
+		CounterID: counterId,
+		Actor:     counterId,
+	})
+	rs.broadcastWaitEstimate(ctx, roomId)
+	return nil
+}
+
+// ProcessNextQueue moves the first queue in main queue to counter queue
+func (rs *RoomService) ProcessNextQueue(ctx context.Context, roomId, counterId string) (string, error) {
+	room, exists := rs.rooms[roomId]
+	if !exists {
+		return "", errors.New("room not found")
+	}
+
+	_, exists = room.Counters[counterId]
+	if !exists {
+		return "", errors.New("counter not found in room")
+	}
+
+	queueNumber, err := room.ProcessNextQueue(ctx, counterId)
+	if err != nil {
+		return "", err
+	}
+
+	rs.appendJourney(ctx, queueNumber, models.TicketJourneyEntry{
+		Action:    models.TicketActionProcess,
+		RoomID:    roomId,
+		Queue:     "counter",
+		CounterID: counterId,
+		Actor:     counterId,
+	})
+	rs.broadcastWaitEstimate(ctx, roomId)
+	return queueNumber, nil
+}
+
+func (rs *RoomService) GetCounterQueue(ctx context.Context, roomId, counterId string) (models.QueueItem, error) {
+	room, exists := rs.rooms[roomId]
+	if !exists {
+		return models.QueueItem{}, errors.New("room not found")
+	}
+
+	_, exists = room.Counters[counterId]
+	if !exists {
+		return models.QueueItem{}, errors.New("counter not found in room")
+	}
+
+	return room.GetCounterQueue(ctx, counterId)
 }
 
 func (rs *RoomService) SkipQueue(ctx context.Context, roomId, counterId, queueNumber string) error {
@@ -114,7 +314,19 @@ func (rs *RoomService) SkipQueue(ctx context.Context, roomId, counterId, queueNu
 		return errors.New("counter not found in room")
 	}
 
-	return room.SkipQueue(ctx, counterId, queueNumber)
+	if err := room.SkipQueue(ctx, counterId, queueNumber); err != nil {
+		return err
+	}
+	ticketsSkippedTotal.WithLabelValues(roomId, counterId).Inc()
+
+	rs.appendJourney(ctx, queueNumber, models.TicketJourneyEntry{
+		Action: models.TicketActionSkip,
+		RoomID: roomId,
+		Queue:  "skip",
+		Actor:  counterId,
+	})
+	rs.broadcastWaitEstimate(ctx, roomId)
+	return nil
 }
 
 func (rs *RoomService) MoveQueue(ctx context.Context, sourceRoomId, destRoomId, counterId, queueNumber string) error {
@@ -136,7 +348,29 @@ func (rs *RoomService) MoveQueue(ctx context.Context, sourceRoomId, destRoomId,
 		return errors.New("counter not found in room")
 	}
 
-	return sourceRoom.MoveQueue(ctx, counterId, queueNumber, destRoom)
+	if err := sourceRoom.MoveQueue(ctx, counterId, queueNumber, destRoom); err != nil {
+		return err
+	}
+	ticketsMovedTotal.WithLabelValues(sourceRoomId, destRoomId).Inc()
+
+	rs.appendJourney(ctx, queueNumber, models.TicketJourneyEntry{
+		Action:     models.TicketActionMove,
+		RoomID:     destRoomId,
+		FromRoomID: sourceRoomId,
+		Queue:      "main",
+		Actor:      counterId,
+	})
+
+	rs.broadcastWaitEstimate(ctx, sourceRoomId)
+	rs.broadcastWaitEstimate(ctx, destRoomId)
+	return nil
+}
+
+// journey is only for tracing, so failing to record it shouldn't fail the queue operation
+func (rs *RoomService) appendJourney(ctx context.Context, queueNumber string, entry models.TicketJourneyEntry) {
+	if err := models.NewTicketJourney(queueNumber).Append(ctx, entry); err != nil {
+		logs.Error("failed to record journey of %s: %s", queueNumber, err.Error())
+	}
 }
 
 func isActionAllowed(action models.RoomAction, sourceRoom, destRoom *models.Room) bool {
@@ -160,6 +394,45 @@ func (rs *RoomService) GetRoom(ctx context.Context, roomId string) (*models.Room
 	return room, nil
 }
 
+func (rs *RoomService) ListRoomIDs() []string {
+	roomIds := make([]string, 0, len(rs.rooms))
+	for roomId := range rs.rooms {
+		roomIds = append(roomIds, roomId)
+	}
+	slices.Sort(roomIds)
+	return roomIds
+}
+
+// RoomSummary is a room and how many more tickets it accepts
+type RoomSummary struct {
+	RoomID   string                              `json:"room_id"`
+	RoomName string                              `json:"room_name"`
+	Counters map[string]models.RoomCounterDetail `json:"counters"`
+	Status   models.RoomOpenStatus               `json:"status"`
+	Capacity models.RoomCapacityStatus           `json:"capacity"`
+}
+
+func (rs *RoomService) ListRooms(ctx context.Context) ([]RoomSummary, error) {
+	summaries := make([]RoomSummary, 0, len(rs.rooms))
+	for _, roomId := range rs.ListRoomIDs() {
+		room := rs.rooms[roomId]
+
+		capacity, err := room.GetCapacity(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		summaries = append(summaries, RoomSummary{
+			RoomID:   room.Id,
+			RoomName: room.Name,
+			Counters: room.Counters,
+			Status:   room.GetOpenStatus(),
+			Capacity: capacity,
+		})
+	}
+	return summaries, nil
+}
+
 func (rs *RoomService) GetRoomQueues(ctx context.Context, roomId string) (map[string][]models.QueueItem, error) {
 	room, exists := rs.rooms[roomId]
 	if !exists {
@@ -168,6 +441,48 @@ func (rs *RoomService) GetRoomQueues(ctx context.Context, roomId string) (map[st
 	return room.GetQueues(ctx)
 }
 
+func (rs *RoomService) GetRoomWaitEstimate(ctx context.Context, roomId string) (models.WaitEstimate, error) {
+	room, exists := rs.rooms[roomId]
+	if !exists {
+		return models.WaitEstimate{}, errors.New("room not found")
+	}
+	return room.GetWaitEstimate(ctx)
+}
+
+// broadcastWaitEstimate notifies room clients of the new wait estimate, if it changed since last broadcast
+func (rs *RoomService) broadcastWaitEstimate(ctx context.Context, roomId string) {
+	estimate, err := rs.GetRoomWaitEstimate(ctx, roomId)
+	if err != nil {
+		logs.Error("failed to estimate wait of room %s: %s", roomId, err.Error())
+		return
+	}
+
+	rs.estimatesMu.Lock()
+	last, ok := rs.estimates[roomId]
+	isChanged := !ok || !isWaitEstimateEqual(last, estimate)
+	rs.estimates[roomId] = estimate
+	rs.estimatesMu.Unlock()
+
+	if !isChanged {
+		return
+	}
+
+	event, err := models.NewEvent(models.EventWaitEstimate, estimate)
+	if err != nil {
+		logs.Error("fail to create wait estimate event: %s", err.Error())
+		return
+	}
+	rs.eventHubService.Broadcast(roomId, event)
+}
+
+func isWaitEstimateEqual(a, b models.WaitEstimate) bool {
+	return a.AvgServiceSeconds == b.AvgServiceSeconds &&
+		a.OpenCounters == b.OpenCounters &&
+		a.Waiting == b.Waiting &&
+		a.WaitSeconds == b.WaitSeconds &&
+		maps.Equal(a.CounterAvgSeconds, b.CounterAvgSeconds)
+}
+
 func (rs *RoomService) GetRoomDetails(ctx context.Context, roomId string) (models.RoomDetail, map[string]models.RoomCounterDetail, error) {
 	room, exists := rs.rooms[roomId]
 	if !exists {
@@ -176,3 +491,47 @@ func (rs *RoomService) GetRoomDetails(ctx context.Context, roomId string) (model
 
 	return room.RoomDetail, room.Counters, nil
 }
+
+// RoomSnapshot is full state of a room, sent to clients which can't catch up with room events
+type RoomSnapshot struct {
+	Details RoomSnapshotDetails           `json:"details"`
+	Queues  map[string][]models.QueueItem `json:"queues"`
+	Wait    models.WaitEstimate           `json:"wait"`
+	// filled by caller, since announcements are not part of room
+	Announcements []models.Announcement `json:"announcements"`
+}
+
+type RoomSnapshotDetails struct {
+	RoomID   string                              `json:"room_id"`
+	RoomName string                              `json:"room_name"`
+	Counters map[string]models.RoomCounterDetail `json:"counters"`
+	Status   models.RoomOpenStatus               `json:"status"`
+}
+
+func (rs *RoomService) GetRoomSnapshot(ctx context.Context, roomId string) (RoomSnapshot, error) {
+	room, exists := rs.rooms[roomId]
+	if !exists {
+		return RoomSnapshot{}, errors.New("room not found")
+	}
+
+	queues, err := room.GetQueues(ctx)
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+
+	wait, err := room.GetWaitEstimate(ctx)
+	if err != nil {
+		return RoomSnapshot{}, err
+	}
+
+	return RoomSnapshot{
+		Details: RoomSnapshotDetails{
+			RoomID:   room.Id,
+			RoomName: room.Name,
+			Counters: room.Counters,
+			Status:   room.GetOpenStatus(),
+		},
+		Queues: queues,
+		Wait:   wait,
+	}, nil
+}
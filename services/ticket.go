@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/tommywijayac/duck-queue-server-v2/models"
+)
+
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// TicketService serves public ticket lookup, e.g. from QR code printed on the ticket
+type TicketService struct {
+	lookupLimiter *models.RateLimiter
+
+	// dependencies
+	roomService *RoomService
+}
+
+func NewTicketService(roomService *RoomService) *TicketService {
+	limit, err := web.AppConfig.Int("ticket::lookup_rate_limit")
+	if err != nil || limit < 0 {
+		limit = 30
+	}
+
+	return &TicketService{
+		lookupLimiter: models.NewRateLimiter("ticket_lookup", limit, time.Minute),
+		roomService:   roomService,
+	}
+}
+
+// AllowLookup counts a lookup request of the client IP. If it's over the limit, it returns false and duration to retry after.
+func (ts *TicketService) AllowLookup(ctx context.Context, ip string) (bool, time.Duration) {
+	isAllowed, retryAfter, err := ts.lookupLimiter.Allow(ctx, ip)
+	if err != nil {
+		// rate limit protects lookup, it shouldn't make lookup unavailable
+		logs.Error("failed to check ticket lookup rate limit: %s", err.Error())
+		return true, 0
+	}
+	return isAllowed, retryAfter
+}
+
+// GetStatus finds the ticket in all rooms. Ticket keeps its number when moved to other room,
+// so it's not necessarily in the room of its prefix.
+func (ts *TicketService) GetStatus(ctx context.Context, queueNumber string) (models.TicketStatus, error) {
+	for _, roomId := range ts.roomService.ListRoomIDs() {
+		room, err := ts.roomService.GetRoom(ctx, roomId)
+		if err != nil {
+			return models.TicketStatus{}, err
+		}
+
+		ticket, isFound, err := room.FindTicket(ctx, queueNumber)
+		if err != nil {
+			return models.TicketStatus{}, err
+		}
+		if isFound {
+			return ticket, nil
+		}
+	}
+
+	return models.TicketStatus{}, ErrTicketNotFound
+}
+
+// GetHistory returns journey of the ticket, oldest first. Last step of a ticket still in queue lasts until now.
+func (ts *TicketService) GetHistory(ctx context.Context, queueNumber string) ([]models.TicketJourneyEntry, error) {
+	entries, err := models.NewTicketJourney(queueNumber).List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrTicketNotFound
+	}
+
+	_, err = ts.GetStatus(ctx, queueNumber)
+	if err == nil {
+		last := &entries[len(entries)-1]
+		last.Duration = int(time.Since(last.Timestamp).Seconds())
+	} else if !errors.Is(err, ErrTicketNotFound) {
+		return nil, err
+	}
+
+	return entries, nil
+}